@@ -12,8 +12,9 @@ type GdalGeo = []byte
 
 // 图斑矢量
 type Speckle struct {
-	Geom      GdalGeo // 图斑的矢量面WKB
-	ClassName string  // 标签名
+	Geom      GdalGeo    // 图斑的矢量面WKB
+	ClassName string     // 标签名
+	Attrs     Attributes // 图斑的全部属性字段（解析时填充，写出时按值类型创建对应字段）
 }
 
 type TideSpeckle struct {
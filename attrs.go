@@ -0,0 +1,171 @@
+package gdalib
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+const (
+	attrStrMinWidth = 1
+	attrStrMaxWidth = 254 // dbf字符字段的最大宽度
+)
+
+// 属性字段定义（由图斑属性值推断）
+type attrField struct {
+	name  string
+	ft    gdal.FieldType
+	width int
+}
+
+// 获取属性值对应的OGR字段类型，nil或不支持的类型返回false
+func attrFieldType(v interface{}) (ft gdal.FieldType, ok bool) {
+	ok = true
+	switch v.(type) {
+	case int32, int16, int8, uint16, uint8:
+		ft = gdal.FT_Integer
+	case int64, int, uint32:
+		ft = gdal.FT_Integer64
+	case float64, float32:
+		ft = gdal.FT_Real
+	case string:
+		ft = gdal.FT_String
+	case Date:
+		ft = gdal.FT_Date
+	case time.Time:
+		ft = gdal.FT_DateTime
+	default:
+		ok = false
+	}
+	return
+}
+
+// 同名字段出现不同类型的值时，取能同时容纳两者的字段类型
+func mergeFieldType(a, b gdal.FieldType) gdal.FieldType {
+	if a == b {
+		return a
+	}
+	isInt := func(t gdal.FieldType) bool { return t == gdal.FT_Integer || t == gdal.FT_Integer64 }
+	isNum := func(t gdal.FieldType) bool { return isInt(t) || t == gdal.FT_Real }
+	isTime := func(t gdal.FieldType) bool { return t == gdal.FT_Date || t == gdal.FT_DateTime }
+	switch {
+	case isInt(a) && isInt(b):
+		return gdal.FT_Integer64
+	case isNum(a) && isNum(b):
+		return gdal.FT_Real
+	case isTime(a) && isTime(b):
+		return gdal.FT_DateTime
+	}
+	return gdal.FT_String
+}
+
+// 汇总所有图斑的属性字段（按字段名排序，跳过标签字段）
+func collectAttrFields(speckles []Speckle, labelField string) (fields []attrField) {
+	idx := map[string]int{}
+	for _, sp := range speckles {
+		for name, v := range sp.Attrs {
+			if name == labelField || v == nil {
+				continue
+			}
+			ft, ok := attrFieldType(v)
+			if !ok {
+				ft = gdal.FT_String
+			}
+			width := 0
+			if ft == gdal.FT_String {
+				width = len(fmt.Sprint(v))
+			}
+			if i, exist := idx[name]; exist {
+				fields[i].ft = mergeFieldType(fields[i].ft, ft)
+				if width > fields[i].width {
+					fields[i].width = width
+				}
+				continue
+			}
+			idx[name] = len(fields)
+			fields = append(fields, attrField{name: name, ft: ft, width: width})
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	return
+}
+
+// 在图层中创建图斑属性对应的字段，返回字段名 -> 字段序号
+func (g *GdalToolbox) initAttrFields(layer gdal.Layer, labelField string, speckles []Speckle) (fieldIdx map[string]int, err error) {
+	fields := collectAttrFields(speckles, labelField)
+	if len(fields) == 0 {
+		return
+	}
+	for _, f := range fields {
+		fd := gdal.CreateFieldDefinition(f.name, f.ft)
+		if f.ft == gdal.FT_String {
+			width := f.width
+			if width < attrStrMinWidth {
+				width = attrStrMinWidth
+			} else if width > attrStrMaxWidth {
+				width = attrStrMaxWidth
+			}
+			fd.SetWidth(width)
+		}
+		err = layer.CreateField(fd, false)
+		fd.Destroy()
+		if err != nil {
+			g.logger.Error(g.logTag+"err in create attr field", zap.String("field", f.name), zap.String("type", f.ft.Name()), zap.Error(err))
+			return
+		}
+	}
+	// 部分驱动（如shp）会截断或改写字段名，故按创建顺序取回序号
+	def := layer.Definition()
+	fieldIdx = make(map[string]int, len(fields))
+	base := def.FieldCount() - len(fields)
+	for i, f := range fields {
+		fieldIdx[f.name] = base + i
+	}
+	g.logger.Info(g.logTag+"attr fields created", zap.Int("cnt", len(fields)))
+	return
+}
+
+// 将图斑属性写入要素
+func setAttrs(feature gdal.Feature, fieldIdx map[string]int, attrs Attributes) {
+	for name, v := range attrs {
+		idx, ok := fieldIdx[name]
+		if !ok || v == nil {
+			continue
+		}
+		switch fv := v.(type) {
+		case int32:
+			feature.SetFieldInteger(idx, int(fv))
+		case int16:
+			feature.SetFieldInteger(idx, int(fv))
+		case int8:
+			feature.SetFieldInteger(idx, int(fv))
+		case uint16:
+			feature.SetFieldInteger(idx, int(fv))
+		case uint8:
+			feature.SetFieldInteger(idx, int(fv))
+		case int64:
+			feature.SetFieldInteger64(idx, fv)
+		case int:
+			feature.SetFieldInteger64(idx, int64(fv))
+		case uint32:
+			feature.SetFieldInteger64(idx, int64(fv))
+		case float64:
+			feature.SetFieldFloat64(idx, fv)
+		case float32:
+			feature.SetFieldFloat64(idx, float64(fv))
+		case string:
+			feature.SetFieldString(idx, fv)
+		case Date:
+			feature.SetFieldDateTime(idx, time.Time(fv))
+		case time.Time:
+			feature.SetFieldDateTime(idx, fv)
+		default:
+			feature.SetFieldString(idx, fmt.Sprint(fv))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package gdalib
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// 并发批处理：按workers个协程分派各项任务，结果与输入顺序一致
+// 有单项失败时返回*BatchError（失败项的结果为零值）；ctx取消时返回ctx的错误
+func runBatch[T, R any](ctx context.Context, items []T, workers int, fn func(T) (R, error)) (rets []R, err error) {
+	n := len(items)
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+	rets = make([]R, n)
+	var (
+		errs = make([]error, n)
+		jobs = make(chan int)
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				rets[i], errs[i] = fn(items[i])
+			}
+		}()
+	}
+dispatch:
+	for i := range items {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err = ctx.Err(); err != nil {
+		rets = nil
+		return
+	}
+	var be *BatchError
+	for i, e := range errs {
+		if e == nil {
+			continue
+		}
+		if be == nil {
+			be = &BatchError{}
+		}
+		be.Failures = append(be.Failures, BatchFailure{Index: i, Err: e})
+	}
+	if be != nil {
+		err = be
+	}
+	return
+}
+
+// 批量转换WKB坐标系，workers为并发数（<=0时为CPU核数）
+func (g *GdalToolbox) TransformWkbBatch(gs []GdalGeo, srid, tSrid int, workers int) (rets []GdalGeo, err error) {
+	return g.TransformWkbBatchContext(context.Background(), gs, srid, tSrid, workers)
+}
+
+// 批量转换WKB坐标系（可通过ctx取消）
+func (g *GdalToolbox) TransformWkbBatchContext(ctx context.Context, gs []GdalGeo, srid, tSrid int, workers int) (rets []GdalGeo, err error) {
+	rets, err = runBatch(ctx, gs, workers, func(wkb GdalGeo) (GdalGeo, error) {
+		return g.TransformWkb(wkb, srid, tSrid)
+	})
+	g.logger.Info(g.logTag+"transform wkb batch done", zap.Int("cnt", len(gs)), zap.Int("srid", srid), zap.Int("tSrid", tSrid), zap.Error(err))
+	return
+}
+
+// 批量WKT转WKB，workers为并发数（<=0时为CPU核数）
+func (g *GdalToolbox) WktToWkbBatch(wkts []string, srid int, workers int) (rets []GdalGeo, err error) {
+	return g.WktToWkbBatchContext(context.Background(), wkts, srid, workers)
+}
+
+// 批量WKT转WKB（可通过ctx取消）
+func (g *GdalToolbox) WktToWkbBatchContext(ctx context.Context, wkts []string, srid int, workers int) (rets []GdalGeo, err error) {
+	rets, err = runBatch(ctx, wkts, workers, func(wkt string) (GdalGeo, error) {
+		return g.WktToWkb(wkt, srid)
+	})
+	g.logger.Info(g.logTag+"wkt to wkb batch done", zap.Int("cnt", len(wkts)), zap.Int("srid", srid), zap.Error(err))
+	return
+}
+
+// 批量求WKB矢量面之差（gAs[i] - gBs[i]），workers为并发数（<=0时为CPU核数）
+func (g *GdalToolbox) DifferenceBatch(gAs, gBs []GdalGeo, srid int, workers int) (rets []GdalGeo, err error) {
+	return g.DifferenceBatchContext(context.Background(), gAs, gBs, srid, workers)
+}
+
+// 批量求WKB矢量面之差（可通过ctx取消）
+func (g *GdalToolbox) DifferenceBatchContext(ctx context.Context, gAs, gBs []GdalGeo, srid int, workers int) (rets []GdalGeo, err error) {
+	if len(gAs) != len(gBs) {
+		err = ErrBatchLength
+		return
+	}
+	idx := make([]int, len(gAs))
+	for i := range idx {
+		idx[i] = i
+	}
+	rets, err = runBatch(ctx, idx, workers, func(i int) (GdalGeo, error) {
+		return g.Difference(gAs[i], gBs[i], srid)
+	})
+	g.logger.Info(g.logTag+"difference batch done", zap.Int("cnt", len(gAs)), zap.Int("srid", srid), zap.Error(err))
+	return
+}
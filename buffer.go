@@ -0,0 +1,70 @@
+package gdalib
+
+import (
+	"math"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 缓冲距离单位
+type BufferUnit int
+
+const (
+	BufferMeters   BufferUnit = iota // 米：各部分先投影到所在的UTM分带再缓冲，缓冲后转回原坐标系
+	BufferCRSUnits                   // 几何所在坐标系的单位（4326下为度）
+)
+
+// 经纬度所在的WGS84 UTM分带投影（北半球326xx，南半球327xx）
+func utmSrid(lon, lat float64) int {
+	zone := int(math.Floor((lon+180)/6)) + 1
+	if zone < 1 {
+		zone = 1
+	} else if zone > 60 {
+		zone = 60
+	}
+	if lat < 0 {
+		return 32700 + zone
+	}
+	return 32600 + zone
+}
+
+// 缓冲函数，返回的几何需调用方Destroy
+type bufferFunc func(geo gdal.Geometry) (gdal.Geometry, error)
+
+// 按距离及其单位生成缓冲函数，ref为几何所在坐标系（需为地理坐标系才可按米缓冲）
+func (g *GdalToolbox) newBuffer(dis float64, unit BufferUnit, ref gdal.SpatialReference) bufferFunc {
+	if unit == BufferCRSUnits {
+		return func(geo gdal.Geometry) (gdal.Geometry, error) {
+			return geo.Buffer(dis, MergeBufferSegs), nil
+		}
+	}
+	return func(geo gdal.Geometry) (gdal.Geometry, error) {
+		return g.bufferMeters(geo, dis, ref)
+	}
+}
+
+// 在几何中心所在的UTM分带中按米缓冲
+func (g *GdalToolbox) bufferMeters(geo gdal.Geometry, dis float64, ref gdal.SpatialReference) (ret gdal.Geometry, err error) {
+	env := geo.Envelope()
+	srid := utmSrid((env.MinX()+env.MaxX())/2, (env.MinY()+env.MaxY())/2)
+	localRef, err := g.getSridRef(srid)
+	if err != nil {
+		return
+	}
+	defer localRef.Release()
+	local := geo.Clone()
+	defer local.Destroy()
+	local.SetSpatialReference(ref)
+	if err = local.TransformTo(localRef); err != nil {
+		g.logger.Error(g.logTag+"transform to local utm failed", zap.Int("srid", srid), zap.Error(err))
+		return
+	}
+	ret = local.Buffer(dis, MergeBufferSegs)
+	if err = ret.TransformTo(ref); err != nil {
+		g.logger.Error(g.logTag+"transform back from local utm failed", zap.Int("srid", srid), zap.Error(err))
+		ret.Destroy()
+		ret = gdal.Geometry{}
+	}
+	return
+}
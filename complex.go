@@ -1,7 +1,8 @@
 package gdalib
 
 import (
-	"github.com/wgdzlh/gdalib/log"
+	"context"
+
 	"github.com/wgdzlh/gdalib/utils"
 
 	"github.com/lukeroth/gdal"
@@ -10,71 +11,141 @@ import (
 
 // 拆分、凸包+缓冲、合并目标区域WKB，输出GeoJSON
 func (g *GdalToolbox) ProcessZoneMerge(uc *Uncertainty, dis int) (ret AnyJson, err error) {
-	log.Info(g.logTag+"start process zone merge", zap.Int("ucSize", len(uc.Geom)), zap.Int("id", uc.Id), zap.Int("dis", dis))
+	return g.ProcessZoneMergeContext(context.Background(), uc, dis)
+}
+
+// 拆分、凸包+缓冲、合并目标区域WKB，输出GeoJSON（可通过ctx取消）
+// dis为缓冲距离（米），不大于0时按默认距离（度，见WithMergeBuffer）缓冲
+func (g *GdalToolbox) ProcessZoneMergeContext(ctx context.Context, uc *Uncertainty, dis int) (ret AnyJson, err error) {
+	if dis > 0 {
+		return g.ProcessZoneMergeBufferContext(ctx, uc, float64(dis), BufferMeters)
+	}
+	return g.ProcessZoneMergeBufferContext(ctx, uc, g.mergeBuffer, BufferCRSUnits)
+}
+
+// 拆分、凸包+缓冲、合并目标区域WKB，输出GeoJSON，缓冲距离dis的单位由unit指定
+func (g *GdalToolbox) ProcessZoneMergeBuffer(uc *Uncertainty, dis float64, unit BufferUnit) (ret AnyJson, err error) {
+	return g.ProcessZoneMergeBufferContext(context.Background(), uc, dis, unit)
+}
+
+// 拆分、凸包+缓冲、合并目标区域WKB，输出GeoJSON，缓冲距离dis的单位由unit指定（可通过ctx取消）
+func (g *GdalToolbox) ProcessZoneMergeBufferContext(ctx context.Context, uc *Uncertainty, dis float64, unit BufferUnit) (ret AnyJson, err error) {
+	g.logger.Info(g.logTag+"start process zone merge", zap.Int("ucSize", len(uc.Geom)), zap.Int("id", uc.Id), zap.Float64("dis", dis), zap.Int("unit", int(unit)))
 	ref, err := g.getSridRef(GEOJSON_SRID)
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	mergedSg, err := g.parseWKB(uc.Geom, ref)
 	if err != nil {
 		return
 	}
 	defer mergedSg.Destroy()
-	mergeDis := MergeBufferDistance
-	if dis > 0 {
-		mergeDis = float64(dis) * MergeBufferMeter
-	}
 	// 缓冲 + 合并
-	unionGeo := g.splitAndHullBuff(mergedSg, mergeDis)
+	unionGeo, err := g.splitAndHullBuff(ctx, mergedSg, g.newBuffer(dis, unit, ref))
+	if err != nil {
+		return
+	}
 	defer unionGeo.Destroy()
 	// 再次拆分 + 凸包
-	ucGeo := g.splitAndHullBuff(unionGeo)
+	ucGeo, err := g.splitAndHullBuff(ctx, unionGeo, nil)
+	if err != nil {
+		return
+	}
 	defer ucGeo.Destroy()
 	ret = utils.S2B(ucGeo.ToJSON())
-	log.Info(g.logTag+"output merge json", zap.Int("id", uc.Id), zap.Int("dis", dis))
+	g.logger.Info(g.logTag+"output merge json", zap.Int("id", uc.Id), zap.Float64("dis", dis))
 	return
 }
 
-func (g *GdalToolbox) splitAndHullBuff(geo gdal.Geometry, dis ...float64) (rGeo gdal.Geometry) {
+// 拆分几何并对各部分求凸包，buff非空时再缓冲，最后合并
+func (g *GdalToolbox) splitAndHullBuff(ctx context.Context, geo gdal.Geometry, buff bufferFunc) (rGeo gdal.Geometry, err error) {
 	var gc []destroyable
+	defer func() {
+		if err != nil {
+			gc = append(gc, rGeo)
+		}
+		for _, v := range gc {
+			v.Destroy()
+		}
+	}()
 	if geo.Type() == gdal.GT_Polygon {
 		rGeo = geo.ConvexHull()
-		gc = append(gc, rGeo)
-		if len(dis) > 0 {
-			rGeo = rGeo.Buffer(dis[0], MergeBufferSegs)
+		if buff != nil {
+			gc = append(gc, rGeo)
+			rGeo, err = buff(rGeo)
 		}
 	} else {
 		rGeo = gdal.Create(gdal.GT_Polygon)
 		geoCount := geo.GeometryCount()
 		for i := 0; i < geoCount; i++ {
+			if err = ctx.Err(); err != nil {
+				return
+			}
 			subGeo := geo.Geometry(i)
 			if subGeo.Type() != gdal.GT_Polygon {
-				log.Error(g.logTag+"wrong type in geom", zap.Uint("type", uint(subGeo.Type())))
+				g.logger.Error(g.logTag+"wrong type in geom", zap.Uint("type", uint(subGeo.Type())))
 				continue
 			}
 			subGeo = subGeo.ConvexHull()
 			gc = append(gc, subGeo)
-			if len(dis) > 0 {
-				subGeo = subGeo.Buffer(dis[0], MergeBufferSegs)
+			if buff != nil {
+				if subGeo, err = buff(subGeo); err != nil {
+					return
+				}
 				gc = append(gc, subGeo)
 			}
 			gc = append(gc, rGeo)
 			rGeo = rGeo.Union(subGeo)
 		}
 	}
-	for _, v := range gc {
-		v.Destroy()
-	}
 	return
 }
 
+// 覆盖率计算选项
+type CoverageOption func(*coverageConfig)
+
+type coverageConfig struct {
+	geodesic bool // 按椭球面面积计算
+}
+
+// 按椭球面面积（WGS84椭球，见GeodesicArea）而非经纬度平面面积计算覆盖率，适用于大范围或高纬度区域
+func WithGeodesicArea() CoverageOption {
+	return func(cfg *coverageConfig) {
+		cfg.geodesic = true
+	}
+}
+
+func newCoverageConfig(opts []CoverageOption) *coverageConfig {
+	cfg := &coverageConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// 计算4326坐标系下几何的面积
+func (cfg *coverageConfig) area(geo gdal.Geometry) float64 {
+	if cfg.geodesic {
+		return geoGeodesicArea(geo, EllipsoidWGS84)
+	}
+	return geo.Area()
+}
+
 // 获取多个影像范围WKB分别在目标区域中的覆盖率及目标区域、影像范围、未覆盖区域的GeoJSON
-func (g *GdalToolbox) GetAreaCoverage(districtGeom GdalGeo, imagesGeom []GdalGeo) (ratios []float32, dst AnyJson, unions, diffs []AnyJson, err error) {
-	log.Info(g.logTag + "start get area coverage")
+func (g *GdalToolbox) GetAreaCoverage(districtGeom GdalGeo, imagesGeom []GdalGeo, opts ...CoverageOption) (ratios []float32, dst AnyJson, unions, diffs []AnyJson, err error) {
+	return g.GetAreaCoverageContext(context.Background(), districtGeom, imagesGeom, opts...)
+}
+
+// 获取多个影像范围WKB分别在目标区域中的覆盖率及目标区域、影像范围、未覆盖区域的GeoJSON（可通过ctx取消）
+func (g *GdalToolbox) GetAreaCoverageContext(ctx context.Context, districtGeom GdalGeo, imagesGeom []GdalGeo, opts ...CoverageOption) (ratios []float32, dst AnyJson, unions, diffs []AnyJson, err error) {
+	cfg := newCoverageConfig(opts)
+	g.logger.Info(g.logTag + "start get area coverage")
 	ref, err := g.getSridRef(UNIVERSAL_SRID)
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	district, err := g.parseWKB(districtGeom, ref)
 	if err != nil {
 		return
@@ -92,7 +163,9 @@ func (g *GdalToolbox) GetAreaCoverage(districtGeom GdalGeo, imagesGeom []GdalGeo
 		geo          gdal.Geometry
 		ratio        float32
 		interArea    float64
-		districtArea = district.Area()
+		districtArea = cfg.area(district)
+		imgGeos      = make([]gdal.Geometry, n)
+		bounds       = make([]Bounds, n)
 		gc           = []destroyable{district}
 	)
 	defer func() {
@@ -101,48 +174,70 @@ func (g *GdalToolbox) GetAreaCoverage(districtGeom GdalGeo, imagesGeom []GdalGeo
 		}
 	}()
 	for i, imgGeom := range imagesGeom {
-		// unionGeo = gdal.Create(gdal.GT_Polygon)
-		// for _, gs := range imgGeom {
-		if unionGeo, err = g.parseWKB(imgGeom, ref); err != nil {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if imgGeos[i], err = g.parseWKB(imgGeom, ref); err != nil {
 			return
 		}
-		gc = append(gc, unionGeo)
-		// 	unionGeo = unionGeo.Union(subGeo)
-		// }
+		gc = append(gc, imgGeos[i])
+		bounds[i] = geoBounds(imgGeos[i])
+	}
+	// 外包框与目标区域不相交的影像，覆盖率为0，无需求交
+	overlapped := make([]bool, n)
+	for _, i := range NewSpatialIndex(bounds).queryGeometry(district) {
+		overlapped[i] = true
+	}
+	for i := range imgGeos {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		unionGeo = imgGeos[i]
+		// 影像范围合集
+		unions[i] = utils.S2B(unionGeo.ToJSON())
+		if !overlapped[i] {
+			diffs[i] = dst // 差集即目标区域本身
+			continue
+		}
 		// 计算覆盖率
 		geo = district.Intersection(unionGeo)
-		interArea = geo.Area()
+		interArea = cfg.area(geo)
 		gc = append(gc, geo)
 		ratio = float32(interArea / districtArea)
 		ratios[i] = ratio
-		// 影像范围合集
-		unions[i] = utils.S2B(unionGeo.ToJSON())
-		if ratio < CoverageThreshold {
+		if ratio < float32(g.coverageThreshold) {
 			// 地区与影像范围差集
 			geo = district.Difference(unionGeo)
 			diffs[i] = utils.S2B(geo.ToJSON())
 			gc = append(gc, geo)
 		}
 	}
-	log.Info(g.logTag+"got area coverage", zap.Any("ratios", ratios))
+	g.logger.Info(g.logTag+"got area coverage", zap.Any("ratios", ratios))
 	return
 }
 
 // 获取多个影像的集合在目标区域中的覆盖率
-func (g *GdalToolbox) GetAreaCoverageRatio(districtWkt string, imagesWkt []string) (ratio float32, err error) {
-	log.Info(g.logTag + "start get coverage ratio")
+func (g *GdalToolbox) GetAreaCoverageRatio(districtWkt string, imagesWkt []string, opts ...CoverageOption) (ratio float32, err error) {
+	return g.GetAreaCoverageRatioContext(context.Background(), districtWkt, imagesWkt, opts...)
+}
+
+// 获取多个影像的集合在目标区域中的覆盖率（可通过ctx取消）
+func (g *GdalToolbox) GetAreaCoverageRatioContext(ctx context.Context, districtWkt string, imagesWkt []string, opts ...CoverageOption) (ratio float32, err error) {
+	cfg := newCoverageConfig(opts)
+	g.logger.Info(g.logTag + "start get coverage ratio")
 	ref, err := g.getSridRef(UNIVERSAL_SRID)
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	district, err := g.parseWKT(districtWkt, ref)
 	if err != nil {
 		return
 	}
 	var (
-		unionGeo = gdal.Create(gdal.GT_Polygon)
-		subGeo   gdal.Geometry
-		gc       = []destroyable{district, unionGeo}
+		u      = newCascadedUnion()
+		subGeo gdal.Geometry
+		gc     = []destroyable{district, u}
 	)
 	defer func() {
 		for _, v := range gc {
@@ -150,19 +245,22 @@ func (g *GdalToolbox) GetAreaCoverageRatio(districtWkt string, imagesWkt []strin
 		}
 	}()
 	for _, gs := range imagesWkt {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		if subGeo, err = g.parseWKT(gs, ref); err != nil {
 			return
 		}
-		unionGeo = unionGeo.Union(subGeo)
-		gc = append(gc, subGeo)
-		gc = append(gc, unionGeo)
+		u.addDirectly(subGeo)
 	}
+	unionGeo := u.union()
+	gc = append(gc, unionGeo)
 	// 计算覆盖率
-	districtArea := district.Area()
+	districtArea := cfg.area(district)
 	unionGeo = district.Intersection(unionGeo)
-	interArea := unionGeo.Area()
+	interArea := cfg.area(unionGeo)
 	gc = append(gc, unionGeo)
 	ratio = float32(interArea / districtArea)
-	log.Info(g.logTag+"got coverage ratio", zap.Float32("ratio", ratio))
+	g.logger.Info(g.logTag+"got coverage ratio", zap.Float32("ratio", ratio))
 	return
 }
@@ -1,25 +1,29 @@
 package gdalib
 
 const (
-	FILE_EXT_SHP    = ".shp"
-	FILE_EXT_CPG    = ".cpg"
-	FILE_EXT_JSON   = ".json"
-	SHAPE_ENCODING  = "UTF-8"
-	UTF8_ENC        = "UTF8"
-	ZH_ENC          = "GBK"
-	SHP_DRIVER_NAME = "ESRI Shapefile"
-	ENCODING_OPTION = "ENCODING=" + SHAPE_ENCODING
-	OO_ENCODING     = "ENCODING=" + ZH_ENC
-	UNIVERSAL_SRID  = 4326
-	GEOJSON_SRID    = 4326
-	OUTPUT_SRID     = 4490
-	WKT_ALG_SRID    = 3857
+	FILE_EXT_SHP     = ".shp"
+	FILE_EXT_CPG     = ".cpg"
+	FILE_EXT_JSON    = ".json"
+	FILE_EXT_GPKG    = ".gpkg"
+	FILE_EXT_GEOJSON = ".geojson"
+	FILE_EXT_FGB     = ".fgb"
+	FILE_EXT_CSV     = ".csv"
+	SHAPE_ENCODING   = "UTF-8"
+	UTF8_ENC         = "UTF8"
+	ZH_ENC           = "GBK"
+	SHP_DRIVER_NAME  = "ESRI Shapefile"
+	ENCODING_OPTION  = "ENCODING=" + SHAPE_ENCODING
+	OO_ENCODING      = "ENCODING=" + ZH_ENC
+	UNIVERSAL_SRID   = 4326
+	GEOJSON_SRID     = 4326
+	OUTPUT_SRID      = 4490
+	WKT_ALG_SRID     = 3857
 
 	ErrColumnMissingTemplate = `shp文件中缺失【%s】字段`
 	ErrColumnEmptyTemplate   = `shp文件图斑中【%s】字段为空`
 
 	MergeBufferDistance = 0.005
-	MergeBufferMeter    = 0.00001
+	MergeBufferMeter    = 0.00001 // 已弃用：按度近似米，随纬度变化且经纬向不一致，ProcessZoneMerge现按米在UTM分带中缓冲
 	MergeBufferSegs     = 24
 	CoverageThreshold   = 0.9999
 
@@ -29,6 +33,7 @@ const (
 	SHP_FIELD_OID = "oid"
 
 	TMP_GEOJSON = "geo_%s.json"
+	TMP_FGB     = "burn_%s.fgb"
 
 	geomPrefixLen = 5
 	sridPrefix    = "0103000020E61" // srid 4326 prefix
@@ -37,4 +42,5 @@ const (
 	SHP_FIELD_SID = "站点ID"
 	// SHP_FIELD_LABEL = "区域"
 	SHP_FIELD_TIF = "basename"
+	SHP_FIELD_DN  = "DN" // 栅格转矢量时的像元值字段
 )
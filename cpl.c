@@ -0,0 +1,14 @@
+#include <stdint.h>
+#include "cpl_error.h"
+#include "_cgo_export.h"
+
+// 转发CPL错误到Go，用户数据为收集器的cgo.Handle
+static void gdalibCPLHandler(CPLErr cls, CPLErrorNum num, const char *msg)
+{
+	gdalibGoCPLHandler((int)cls, (int)num, (char *)msg, (uintptr_t)CPLGetErrorHandlerUserData());
+}
+
+void gdalibPushCPLHandler(uintptr_t h)
+{
+	CPLPushErrorHandlerEx(gdalibCPLHandler, (void *)h);
+}
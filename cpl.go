@@ -0,0 +1,148 @@
+package gdalib
+
+/*
+#cgo linux pkg-config: gdal
+#cgo darwin pkg-config: gdal
+#cgo windows LDFLAGS: -lgdal_i
+#include <stdint.h>
+#include "cpl_error.h"
+
+void gdalibPushCPLHandler(uintptr_t h);
+*/
+import "C"
+
+import (
+	"runtime"
+	"runtime/cgo"
+	"strings"
+	"sync"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// GDAL（CPL）消息级别
+type CPLLevel int
+
+const (
+	CPLDebug   CPLLevel = C.CE_Debug
+	CPLWarning CPLLevel = C.CE_Warning
+	CPLFailure CPLLevel = C.CE_Failure
+	CPLFatal   CPLLevel = C.CE_Fatal
+)
+
+func (l CPLLevel) String() string {
+	switch l {
+	case CPLDebug:
+		return "debug"
+	case CPLWarning:
+		return "warning"
+	case CPLFailure:
+		return "failure"
+	case CPLFatal:
+		return "fatal"
+	}
+	return "none"
+}
+
+// 一条GDAL（CPL）警告或错误
+type CPLMessage struct {
+	Level CPLLevel // 级别
+	Num   int      // CPL错误码
+	Msg   string   // 错误信息
+}
+
+// 附带GDAL（CPL）警告与错误信息的错误
+type CPLError struct {
+	Op       string       // 出错的GDAL操作，如VectorTranslate
+	Messages []CPLMessage // 调用期间收集到的警告与错误
+	Err      error        // 底层错误
+}
+
+func (e *CPLError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Op)
+	sb.WriteString(": ")
+	sb.WriteString(e.Err.Error())
+	for _, m := range e.Messages {
+		sb.WriteString("; ")
+		sb.WriteString(m.Level.String())
+		sb.WriteString(": ")
+		sb.WriteString(m.Msg)
+	}
+	return sb.String()
+}
+
+func (e *CPLError) Unwrap() error {
+	return e.Err
+}
+
+// 单次调用的CPL消息收集器
+type cplCollector struct {
+	mu   sync.Mutex // GDAL内部工作线程也可能触发处理器
+	msgs []CPLMessage
+}
+
+//export gdalibGoCPLHandler
+func gdalibGoCPLHandler(cls C.int, num C.int, msg *C.char, h C.uintptr_t) {
+	level := CPLLevel(cls)
+	if level == CPLDebug {
+		return
+	}
+	c := cgo.Handle(h).Value().(*cplCollector)
+	c.mu.Lock()
+	c.msgs = append(c.msgs, CPLMessage{Level: level, Num: int(num), Msg: C.GoString(msg)})
+	c.mu.Unlock()
+}
+
+// 是否将收集到的CPL警告与错误同时输出到日志（默认不输出）
+func (g *GdalToolbox) ForwardCPLErrors(on bool) {
+	g.cplForward = on
+}
+
+// 在安装了CPL错误处理器的线程上执行GDAL操作fn，收集期间的警告与错误；
+// fn出错时返回附带这些信息的*CPLError
+func (g *GdalToolbox) withCPL(op string, fn func() error) (err error) {
+	// CPL错误处理器栈为线程局部，调用期间需固定线程
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	c := &cplCollector{}
+	h := cgo.NewHandle(c)
+	C.gdalibPushCPLHandler(C.uintptr_t(h))
+	err = fn()
+	C.CPLPopErrorHandler()
+	h.Delete()
+	if g.cplForward {
+		for _, m := range c.msgs {
+			fields := []zap.Field{zap.String("op", op), zap.Int("num", m.Num), zap.String("msg", m.Msg)}
+			if m.Level == CPLWarning {
+				g.logger.Warn(g.logTag+"gdal warning", fields...)
+			} else {
+				g.logger.Error(g.logTag+"gdal error", fields...)
+			}
+		}
+	}
+	if err != nil {
+		err = &CPLError{Op: op, Messages: c.msgs, Err: err}
+	}
+	return
+}
+
+// Warp、Translate等GDAL工具函数出错时可能只返回空数据集而不返回错误码，此时返回ErrGdalNullDataset
+func checkDataset(ds gdal.Dataset, err error) (gdal.Dataset, error) {
+	if err == nil && ds == (gdal.Dataset{}) {
+		err = ErrGdalNullDataset
+	}
+	return ds, err
+}
+
+// 调用期间收集到的GDAL错误信息（不含警告），多条时以分号连接
+func (e *CPLError) failures() string {
+	var msgs []string
+	for _, m := range e.Messages {
+		if m.Level >= CPLFailure {
+			msgs = append(msgs, m.Msg)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,132 @@
+package gdalib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// proj.db匹配时可接受的最低置信度（0~100）
+const crsMatchMinConfidence = 90
+
+// 坐标系定义，可为"EPSG:4490"形式的编码、WKT（含ESRI .prj格式）、PROJJSON或PROJ字符串
+type CRS string
+
+// EPSG编码对应的坐标系
+func EPSG(srid int) CRS {
+	return CRS(fmt.Sprintf("EPSG:%d", srid))
+}
+
+// 若为"EPSG:xxxx"形式，返回其编码
+func (c CRS) epsg() (srid int, ok bool) {
+	s := string(c)
+	if len(s) <= 5 || !strings.EqualFold(s[:5], "EPSG:") {
+		return
+	}
+	srid, err := strconv.Atoi(s[5:])
+	ok = err == nil
+	return
+}
+
+// 识别坐标系对应的EPSG编码（依次尝试AUTHORITY节点、AutoIdentifyEPSG、proj.db匹配）
+func (g *GdalToolbox) IdentifyEPSG(crs CRS) (srid int, err error) {
+	if srid, ok := crs.epsg(); ok {
+		return srid, nil
+	}
+	ref, err := g.getCRSRef(crs)
+	if err != nil {
+		return
+	}
+	defer ref.Release()
+	return g.getSrid(ref)
+}
+
+// 获取矢量文件的坐标系：能识别出EPSG编码时为EPSG形式，否则为原坐标系的WKT
+// .prj缺失或与坐标量级不符时按CGCS2000高斯克吕格分带推断（见InferShapefileCRS）
+func (g *GdalToolbox) GetCRSOfShapefile(shp string, opts ...VectorOption) (crs CRS, err error) {
+	crs, _, err = g.shapefileCRS(shp, opts)
+	return
+}
+
+func (g *GdalToolbox) shapefileCRS(shp string, opts []VectorOption) (crs CRS, inferred bool, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
+		return
+	}
+	defer ds.Destroy()
+	sp, srid, inferred, err := g.resolveLayerSrs(shp, layer, newVectorConfig(opts).centralMeridian)
+	if err != nil {
+		return
+	}
+	if inferred {
+		defer sp.Release()
+	}
+	if srid > 0 {
+		crs = EPSG(srid)
+		return
+	}
+	wkt, err := sp.ToWKT()
+	if err != nil {
+		g.logger.Error(g.logTag+"export layer crs failed", zap.String("path", shp), zap.Error(err))
+		err = ErrInvalidCRS
+		return
+	}
+	crs = CRS(wkt)
+	return
+}
+
+// 获取源、目标坐标系，用完需调用Release
+func (g *GdalToolbox) getCRSRefPair(src, dst CRS) (ref, tRef gdal.SpatialReference, err error) {
+	if ref, err = g.getCRSRef(src); err != nil {
+		return
+	}
+	if tRef, err = g.getCRSRef(dst); err != nil {
+		ref.Release()
+	}
+	return
+}
+
+// 按任意坐标系定义转换WKB坐标系
+func (g *GdalToolbox) TransformWkbCRS(wkb GdalGeo, src, dst CRS) (ret GdalGeo, err error) {
+	ref, tRef, err := g.getCRSRefPair(src, dst)
+	if err != nil {
+		return
+	}
+	defer ref.Release()
+	defer tRef.Release()
+	geo, err := g.parseWKB(wkb, ref)
+	if err != nil {
+		return
+	}
+	defer geo.Destroy()
+	if err = geo.TransformTo(tRef); err != nil {
+		g.logger.Error(g.logTag+"geo transform failed", zap.Error(err))
+		return
+	}
+	ret, err = geo.ToWKB()
+	return
+}
+
+// 按任意坐标系定义转换WKT坐标系
+func (g *GdalToolbox) TransformWktCRS(wkt string, src, dst CRS) (ret string, err error) {
+	ref, tRef, err := g.getCRSRefPair(src, dst)
+	if err != nil {
+		return
+	}
+	defer ref.Release()
+	defer tRef.Release()
+	geo, err := g.parseWKT(wkt, ref)
+	if err != nil {
+		return
+	}
+	defer geo.Destroy()
+	if err = geo.TransformTo(tRef); err != nil {
+		g.logger.Error(g.logTag+"geo transform failed", zap.Error(err))
+		return
+	}
+	ret, err = geo.ToWKT()
+	return
+}
@@ -0,0 +1,76 @@
+package gdalib
+
+/*
+#include <stdlib.h>
+#include "cpl_vsi.h"
+#include "ogr_srs_api.h"
+*/
+import "C"
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// 在proj.db中查找与def描述的坐标系等价的EPSG坐标系（OSRFindMatches），
+// 返回置信度不低于minConfidence的最佳匹配编码，无匹配时code为0
+// 绑定库未提供该接口，故经由坐标系定义字符串与C层交换
+func matchEPSG(def string, minConfidence int) (code, confidence int) {
+	cs := C.CString(def)
+	defer C.free(unsafe.Pointer(cs))
+	h := C.OSRNewSpatialReference(nil)
+	defer C.OSRRelease(h)
+	if C.OSRSetFromUserInput(h, cs) != C.OGRERR_NONE {
+		return
+	}
+	var (
+		n    C.int
+		conf *C.int
+	)
+	matches := C.OSRFindMatches(h, nil, &n, &conf)
+	if matches == nil {
+		return
+	}
+	defer C.OSRFreeSRSArray(matches)
+	defer C.VSIFree(unsafe.Pointer(conf))
+	srss := unsafe.Slice(matches, int(n))
+	confs := unsafe.Slice(conf, int(n))
+	for i, srs := range srss {
+		c := int(confs[i])
+		if c < minConfidence || c <= confidence {
+			continue
+		}
+		if auth := C.OSRGetAuthorityName(srs, nil); auth == nil || C.GoString(auth) != "EPSG" {
+			continue
+		}
+		id, err := strconv.Atoi(C.GoString(C.OSRGetAuthorityCode(srs, nil)))
+		if err != nil {
+			continue
+		}
+		code, confidence = id, c
+	}
+	return
+}
+
+// 坐标系定义根节点的EPSG编码（OSRGetAuthorityName/Code以NULL为目标节点即根节点），无则为空；
+// autoIdentify为true时先尝试OSRAutoIdentifyEPSG补全AUTHORITY节点
+// 绑定库的AuthorityName/AuthorityCode传入空字符串而非NULL，取不到根节点，故同样经由定义字符串调用C层
+func rootEPSG(def string, autoIdentify bool) (code string) {
+	cs := C.CString(def)
+	defer C.free(unsafe.Pointer(cs))
+	h := C.OSRNewSpatialReference(nil)
+	defer C.OSRRelease(h)
+	if C.OSRSetFromUserInput(h, cs) != C.OGRERR_NONE {
+		return
+	}
+	if autoIdentify && C.OSRAutoIdentifyEPSG(h) != C.OGRERR_NONE {
+		return
+	}
+	if auth := C.OSRGetAuthorityName(h, nil); auth == nil || C.GoString(auth) != "EPSG" {
+		return
+	}
+	if c := C.OSRGetAuthorityCode(h, nil); c != nil {
+		code = C.GoString(c)
+	}
+	return
+}
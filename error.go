@@ -1,13 +1,31 @@
 package gdalib
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lukeroth/gdal"
+)
 
 var (
 	ErrGdalDriverCreate    = errors.New("gdal driver create err")
 	ErrGdalDriverOpen      = errors.New("gdal driver open err")
+	ErrLayerNotFound       = errors.New("gdal layer not found")
+	ErrPartialWrite        = errors.New("gdal partial write")
+	ErrColumnMissing       = errors.New("gdal column missing")
+	ErrColumnEmpty         = errors.New("gdal column empty")
+	ErrPartialBatch        = errors.New("gdal partial batch")
+	ErrBatchLength         = errors.New("gdal batch inputs length mismatch")
+	ErrMakeValid           = errors.New("gdal make valid failed")
+	ErrRepairFailed        = errors.New("gdal geometry repair failed")
 	ErrGdalEmptyShp        = errors.New("gdal shp is empty")
 	ErrVoidSrid            = errors.New("gdal shp with void srid")
+	ErrInvalidCRS          = errors.New("gdal invalid crs definition")
+	ErrGKZoneUnknown       = errors.New("gdal cannot infer gauss-kruger zone")
+	ErrLonLatSystem        = errors.New("gdal unknown lon/lat coordinate system")
 	ErrGdalDriverCount     = errors.New("gdal driver count err")
+	ErrGdalNullDataset     = errors.New("gdal operation returned no dataset")
 	ErrGdalWrongGeoType    = errors.New("gdal wrong geo type")
 	ErrGdalWrongGeoJSON    = errors.New("gdal wrong GeoJSON")
 	ErrWrongPositionedLine = errors.New("wrong positioned line")
@@ -22,3 +40,132 @@ var (
 	ErrTifReadFailed       = errors.New("failed to read tif band")
 	ErrWrongRasterOffset   = errors.New("wrong raster offset")
 )
+
+// 要素级错误，包含出错的文件、图层、要素ID及GDAL返回的错误信息
+type FeatureError struct {
+	Path   string // 矢量文件
+	Layer  string // 图层名
+	FID    int64  // 要素ID（写入时为要素在输入中的序号）
+	CPLMsg string // GDAL（CPL）错误信息，非GDAL调用产生的错误为空
+	Err    error  // 底层错误
+}
+
+// err为withCPL返回的*CPLError时取出其中的GDAL错误信息
+func newFeatureError(path string, layer gdal.Layer, fid int64, err error) *FeatureError {
+	fe := &FeatureError{Path: path, Layer: layer.Name(), FID: fid, Err: err}
+	var ce *CPLError
+	if errors.As(err, &ce) {
+		fe.CPLMsg, fe.Err = ce.failures(), ce.Err
+	}
+	return fe
+}
+
+func (e *FeatureError) Error() string {
+	msg := fmt.Sprintf("gdal feature %d of %s[%s]: %v", e.FID, e.Path, e.Layer, e.Err)
+	if e.CPLMsg != "" {
+		msg += ": " + e.CPLMsg
+	}
+	return msg
+}
+
+func (e *FeatureError) Unwrap() error {
+	return e.Err
+}
+
+// 字段级错误，Err为ErrColumnMissing时FID为-1
+type FieldError struct {
+	Path   string // 矢量文件
+	Layer  string // 图层名
+	Field  string // 字段名
+	FID    int64  // 要素ID，与具体要素无关时为-1
+	CPLMsg string // GDAL（CPL）错误信息，ErrColumnMissing、ErrColumnEmpty等非GDAL调用产生的错误为空
+	Err    error  // ErrColumnMissing、ErrColumnEmpty等
+}
+
+func newFieldError(path string, layer gdal.Layer, field string, fid int64, err error) *FieldError {
+	return &FieldError{Path: path, Layer: layer.Name(), Field: field, FID: fid, Err: err}
+}
+
+func (e *FieldError) Error() string {
+	var msg string
+	switch e.Err {
+	case ErrColumnMissing:
+		msg = fmt.Sprintf(ErrColumnMissingTemplate, e.Field)
+	case ErrColumnEmpty:
+		msg = fmt.Sprintf(ErrColumnEmptyTemplate, e.Field)
+	default:
+		msg = fmt.Sprintf("gdal field %s: %v", e.Field, e.Err)
+	}
+	msg += fmt.Sprintf("（%s[%s]", e.Path, e.Layer)
+	if e.FID >= 0 {
+		msg += fmt.Sprintf("，要素%d", e.FID)
+	}
+	msg += "）"
+	if e.CPLMsg != "" {
+		msg += ": " + e.CPLMsg
+	}
+	return msg
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// 单个要素写入失败的原因
+type WriteFailure struct {
+	Index int   // 要素在输入中的序号
+	Err   error // 失败原因（*FeatureError）
+}
+
+// 严格模式下有要素写入失败时返回的错误，目标文件不会被改动
+type WriteError struct {
+	Path     string         // 目标文件
+	Failures []WriteFailure // 按序号排列的失败要素
+}
+
+const errMaxShown = 5 // 错误信息中最多列出的失败项数
+
+func (e *WriteError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "gdal write %s: %d features failed", e.Path, len(e.Failures))
+	for i, f := range e.Failures {
+		if i == errMaxShown {
+			sb.WriteString("; ...")
+			break
+		}
+		fmt.Fprintf(&sb, "; #%d: %v", f.Index, f.Err)
+	}
+	return sb.String()
+}
+
+func (e *WriteError) Unwrap() error {
+	return ErrPartialWrite
+}
+
+// 批处理中单项失败的原因
+type BatchFailure struct {
+	Index int   // 输入中的序号
+	Err   error // 失败原因
+}
+
+// 批处理中有单项失败时返回的错误，其余各项结果仍有效
+type BatchError struct {
+	Failures []BatchFailure // 按序号排列的失败项
+}
+
+func (e *BatchError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "gdal batch: %d items failed", len(e.Failures))
+	for i, f := range e.Failures {
+		if i == errMaxShown {
+			sb.WriteString("; ...")
+			break
+		}
+		fmt.Fprintf(&sb, "; #%d: %v", f.Index, f.Err)
+	}
+	return sb.String()
+}
+
+func (e *BatchError) Unwrap() error {
+	return ErrPartialBatch
+}
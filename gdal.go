@@ -1,6 +1,7 @@
 package gdalib
 
 import (
+	"context"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,11 +13,30 @@ import (
 	"go.uber.org/zap"
 )
 
+// GDAL工具箱
+//
+// 并发模型：同一个GdalToolbox可被多个goroutine并发使用。
+// 各方法内创建的GDAL对象（几何、数据集、图层、坐标转换等）都只在本次调用内使用，不跨goroutine共享；
+// 唯一共享的状态是坐标系模板缓存refMap，由rLock保护，且每次取出的都是独立副本（见getCRSRef）。
+// FeatureReader等有状态的对象非并发安全；ForwardCPLErrors等配置方法应在开始并发使用前调用。
+// With返回的派生工具箱与原工具箱共享坐标系缓存，仅日志字段不同。
 type GdalToolbox struct {
-	refMap map[int]gdal.SpatialReference
-	rLock  sync.Mutex
-	tmpDir string
-	logTag string
+	refMap     map[int]gdal.SpatialReference // EPSG编码 -> 坐标系模板
+	rLock      *sync.Mutex
+	tmpDir     string
+	logger     log.Logger
+	logTag     string
+	cplForward bool // 是否将GDAL警告与错误输出到日志
+
+	// 以下为可调参数，由NewGdalToolbox的选项设定，默认取config.go、vecalg.go中的同名常量
+	outputSrid        int
+	algSrid           int
+	mergeBuffer       float64
+	coverageThreshold float64
+	simplifyT         float64
+	minIntersectDist  float64
+	cutBuffer         float64
+	buffPercent       float64
 }
 
 // 由GDAL库C语言创建的内存对象，需要手动调用Destroy回收
@@ -28,30 +48,79 @@ var (
 	emptyGeometry = gdal.Geometry{}
 )
 
-// 初始化GDAL工具箱，tmpDir为可选的临时目录路径（未提供的话为当前目录）
-func NewGdalToolbox(tmpDir ...string) *GdalToolbox {
+// 初始化GDAL工具箱，可通过WithTmpDir、WithOutputSrid等选项调整配置
+func NewGdalToolbox(opts ...ToolboxOption) *GdalToolbox {
 	g := &GdalToolbox{
-		refMap: map[int]gdal.SpatialReference{},
-		logTag: "GdalToolbox:",
-	}
-	if len(tmpDir) > 0 && tmpDir[0] != "" {
-		g.tmpDir = tmpDir[0]
+		refMap:            map[int]gdal.SpatialReference{},
+		rLock:             &sync.Mutex{},
+		logger:            log.Default(),
+		logTag:            "GdalToolbox:",
+		outputSrid:        OUTPUT_SRID,
+		algSrid:           WKT_ALG_SRID,
+		mergeBuffer:       MergeBufferDistance,
+		coverageThreshold: CoverageThreshold,
+		simplifyT:         SimplifyT,
+		minIntersectDist:  MinIntersectDist,
+		cutBuffer:         CutLineBuffDist,
+		buffPercent:       BuffPercent,
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
 	return g
 }
 
-// 获取srid对应的坐标系（可复用，故无需回收）
+// 以指定临时文件目录初始化GDAL工具箱，兼容旧版的NewGdalToolbox(tmpDir)调用
+func NewGdalToolboxWithTmpDir(tmpDir string, opts ...ToolboxOption) *GdalToolbox {
+	return NewGdalToolbox(append([]ToolboxOption{WithTmpDir(tmpDir)}, opts...)...)
+}
+
+// 返回附带日志字段（如请求ID）的派生工具箱，用于按调用区分日志，如g.With(zap.String("reqId", id)).ParseShapefile(...)
+func (g *GdalToolbox) With(fields ...zap.Field) *GdalToolbox {
+	c := *g
+	c.logger = g.logger.With(fields...)
+	return &c
+}
+
+// 获取srid对应的坐标系，用完需调用Release（见getCRSRef）
 func (g *GdalToolbox) getSridRef(srid int) (ref gdal.SpatialReference, err error) {
+	return g.getCRSRef(EPSG(srid))
+}
+
+// 获取坐标系定义对应的坐标系，用完需调用Release
+// OGR坐标系对象非并发安全，refMap中缓存的坐标系只作为模板，每次返回其独立副本
+// （由其创建的几何对象会持有引用计数，故Release后几何对象仍可正常使用）
+// 只缓存EPSG形式的坐标系（种类有限）；WKT、PROJ字符串等任意定义每次新建，避免缓存无限增长
+func (g *GdalToolbox) getCRSRef(crs CRS) (ref gdal.SpatialReference, err error) {
+	srid, isEPSG := crs.epsg()
+	if !isEPSG {
+		return g.newCRSRef(crs)
+	}
 	g.rLock.Lock()
 	defer g.rLock.Unlock()
-	ref, ok := g.refMap[srid]
-	if ok {
-		return
+	tpl, ok := g.refMap[srid]
+	if !ok {
+		if tpl, err = g.newCRSRef(crs); err != nil {
+			return
+		}
+		g.refMap[srid] = tpl
 	}
+	ref = tpl.Clone()
+	ref.SetAxisMappingStrategy(gdal.OAMS_TraditionalGisOrder)
+	return
+}
+
+func (g *GdalToolbox) newCRSRef(crs CRS) (ref gdal.SpatialReference, err error) {
 	ref = gdal.CreateSpatialReference("")
-	if err = ref.FromEPSG(srid); err != nil { // 设定坐标系ID
-		log.Error(g.logTag+"set ref srid failed", zap.Int("srid", srid), zap.Error(err))
+	if srid, ok := crs.epsg(); ok {
+		err = ref.FromEPSG(srid) // 设定坐标系ID
+	} else {
+		err = ref.SetFromUserInput(string(crs)) // WKT（含ESRI格式）、PROJJSON、PROJ字符串等
+	}
+	if err != nil {
+		g.logger.Error(g.logTag+"set ref crs failed", zap.String("crs", string(crs)), zap.Error(err))
 		ref.Destroy()
+		err = ErrInvalidCRS
 		return
 	}
 	// 这里应设置坐标系对应的数据轴次序为固定的(经度,纬度)（传统GIS坐标序），而不是新标准中与CRS相关的次序。否则在转换坐标系或者转GeoJSON时，可能出现次序倒置问题
@@ -60,45 +129,95 @@ func (g *GdalToolbox) getSridRef(srid int) (ref gdal.SpatialReference, err error
 	// OAMS_TRADITIONAL_GIS_ORDER means that for geographic CRS with lat/long order, the data will still be long/lat ordered. Similarly for a projected CRS with northing/easting order, the data will still be easting/northing ordered.
 	// OAMS_AUTHORITY_COMPLIANT means that the data axis will be identical to the CRS axis. This is the default value when instantiating OGRSpatialReference.
 	// OAMS_CUSTOM means that the data axes are customly defined with SetDataAxisToSRSAxisMapping().
-	g.refMap[srid] = ref
 	return
 }
 
+// 获取坐标系的EPSG编码：依次尝试根节点AUTHORITY、AutoIdentifyEPSG、proj.db匹配，最后按名称中的CGCS_2000推断为4490
 func (g *GdalToolbox) getSrid(sp gdal.SpatialReference) (srid int, err error) {
-	// sp.AutoIdentifyEPSG() // 可能对不规范的shp文件需要
+	srid, _, err = g.identifySrid(sp)
+	return
+}
+
+// 获取与坐标系等价的EPSG编码，无法确定时返回0：
+// 按名称推断的编码（如CGCS2000投影坐标系被推断为4490）及与原坐标系地理/投影类型不一致的编码均不采用
+func (g *GdalToolbox) exactSrid(sp gdal.SpatialReference) (srid int) {
+	id, how, err := g.identifySrid(sp)
+	if err != nil || how == sridByName {
+		return
+	}
+	ref, err := g.getSridRef(id)
+	if err != nil {
+		return
+	}
+	defer ref.Release()
+	if ref.IsGeographic() == sp.IsGeographic() && ref.IsProjected() == sp.IsProjected() {
+		srid = id
+	} else {
+		g.logger.Info(g.logTag+"epsg kind mismatch, keep crs as is", zap.Int("srid", id))
+	}
+	return
+}
+
+const sridByName = "name" // 按名称推断的EPSG编码
+
+// 获取坐标系的EPSG编码及其来源
+func (g *GdalToolbox) identifySrid(sp gdal.SpatialReference) (srid int, how string, err error) {
+	if sp == (gdal.SpatialReference{}) {
+		err = ErrVoidSrid
+		return
+	}
 	wkt, _ := sp.ToWKT()
-	log.Info(g.logTag+"spatial ref attrs", zap.String("attr", wkt))
-	rawId, ok := sp.AttrValue("AUTHORITY", 1)
-	if !ok {
+	g.logger.Info(g.logTag+"spatial ref attrs", zap.String("attr", wkt))
+	how = "authority"
+	rawId := rootEPSG(wkt, false)
+	if rawId == "" {
+		// 无AUTHORITY节点（如ESRI格式的.prj），在C层的独立对象上自动识别，不改动原坐标系
+		how = "auto identify"
+		rawId = rootEPSG(wkt, true)
+	}
+	if rawId == "" {
+		how = "proj.db match"
+		if code, confidence := matchEPSG(wkt, crsMatchMinConfidence); code > 0 {
+			rawId = strconv.Itoa(code)
+			g.logger.Info(g.logTag+"matched epsg in proj.db", zap.Int("code", code), zap.Int("confidence", confidence))
+		}
+	}
+	if rawId == "" {
 		if strings.Contains(wkt, "CGCS_2000") {
-			rawId = "4490"
+			rawId, how = "4490", sridByName
 		} else {
 			err = ErrVoidSrid
 			return
 		}
 	}
 	srid, err = strconv.Atoi(rawId)
-	log.Info(g.logTag+"got srid from sp", zap.String("id", rawId))
+	g.logger.Info(g.logTag+"got srid from sp", zap.String("id", rawId), zap.String("by", how))
 	return
 }
 
-// 获取shp的srid
-func (g *GdalToolbox) GetSridOfShapefile(shp string) (srid int, err error) {
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+// 获取图层坐标系的srid；坐标系有效但无法识别出EPSG编码时返回0且不报错（仍可直接用于坐标转换）
+func (g *GdalToolbox) getLayerSrid(sp gdal.SpatialReference) (srid int, err error) {
+	if srid, err = g.getSrid(sp); err == ErrVoidSrid && sp != (gdal.SpatialReference{}) {
+		g.logger.Info(g.logTag + "layer crs without epsg code, use it as is")
+		srid, err = 0, nil
+	}
+	return
+}
+
+// 获取矢量文件（shp、gpkg、geojson等）的srid
+func (g *GdalToolbox) GetSridOfShapefile(shp string, opts ...VectorOption) (srid int, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	layer := ds.LayerByIndex(0)
 	return g.getSrid(layer.SpatialReference())
 }
 
 func (g *GdalToolbox) parseWKB(wkb GdalGeo, ref gdal.SpatialReference) (ret gdal.Geometry, err error) {
 	ret, err = gdal.CreateFromWKB(wkb, ref, len(wkb))
 	if err != nil {
-		log.Error(g.logTag+"parse wkb failed", zap.Error(err))
+		g.logger.Error(g.logTag+"parse wkb failed", zap.Error(err))
 	}
 	return
 }
@@ -106,7 +225,7 @@ func (g *GdalToolbox) parseWKB(wkb GdalGeo, ref gdal.SpatialReference) (ret gdal
 func (g *GdalToolbox) parseWKT(wkt string, ref gdal.SpatialReference) (ret gdal.Geometry, err error) {
 	ret, err = gdal.CreateFromWKT(wkt, ref)
 	if err != nil {
-		log.Error(g.logTag+"parse wkt failed", zap.Error(err))
+		g.logger.Error(g.logTag+"parse wkt failed", zap.Error(err))
 		err = ErrInvalidWKT
 	}
 	return
@@ -118,25 +237,7 @@ func (g *GdalToolbox) TransformWkb(wkb GdalGeo, srid, tSrid int) (ret GdalGeo, e
 		ret = wkb
 		return
 	}
-	ref, err := g.getSridRef(srid)
-	if err != nil {
-		return
-	}
-	tRef, err := g.getSridRef(tSrid)
-	if err != nil {
-		return
-	}
-	geo, err := g.parseWKB(wkb, ref)
-	if err != nil {
-		return
-	}
-	defer geo.Destroy()
-	if err = geo.TransformTo(tRef); err != nil {
-		log.Error(g.logTag+"geo transform failed", zap.Error(err))
-		return
-	}
-	ret, err = geo.ToWKB()
-	return
+	return g.TransformWkbCRS(wkb, EPSG(srid), EPSG(tSrid))
 }
 
 // 转换WKT坐标系
@@ -145,25 +246,7 @@ func (g *GdalToolbox) TransformWkt(wkt string, srid, tSrid int) (ret string, err
 		ret = wkt
 		return
 	}
-	ref, err := g.getSridRef(srid)
-	if err != nil {
-		return
-	}
-	tRef, err := g.getSridRef(tSrid)
-	if err != nil {
-		return
-	}
-	geo, err := g.parseWKT(wkt, ref)
-	if err != nil {
-		return
-	}
-	defer geo.Destroy()
-	if err = geo.TransformTo(tRef); err != nil {
-		log.Error(g.logTag+"geo transform failed", zap.Error(err))
-		return
-	}
-	ret, err = geo.ToWKT()
-	return
+	return g.TransformWktCRS(wkt, EPSG(srid), EPSG(tSrid))
 }
 
 // 检查WKT有效性
@@ -172,6 +255,7 @@ func (g *GdalToolbox) CheckWkt(wkt string, srid int) (err error) {
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	geo, err := g.parseWKT(wkt, ref)
 	if err != nil {
 		return
@@ -186,6 +270,7 @@ func (g *GdalToolbox) WktToWkb(wkt string, srid int) (wkb GdalGeo, err error) {
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	geo, err := g.parseWKT(wkt, ref)
 	if err != nil {
 		return
@@ -201,6 +286,7 @@ func (g *GdalToolbox) WkbToWkt(wkb GdalGeo, srid int) (wkt string, err error) {
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	geo, err := g.parseWKB(wkb, ref)
 	if err != nil {
 		return
@@ -228,6 +314,7 @@ func (g *GdalToolbox) WkbToGeoJSON(wkb GdalGeo, srid int) (ret AnyJson, err erro
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	geo, err := g.parseWKB(wkb, ref)
 	if err != nil {
 		return
@@ -239,40 +326,51 @@ func (g *GdalToolbox) WkbToGeoJSON(wkb GdalGeo, srid int) (ret AnyJson, err erro
 
 // 合并多个WKB矢量面
 func (g *GdalToolbox) Union(gs []GdalGeo, srid int) (ret GdalGeo, err error) {
+	return g.UnionContext(context.Background(), gs, srid)
+}
+
+// 合并多个WKB矢量面（可通过ctx取消，采用级联合并）
+func (g *GdalToolbox) UnionContext(ctx context.Context, gs []GdalGeo, srid int) (ret GdalGeo, err error) {
 	ref, err := g.getSridRef(srid)
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	var (
-		geo      gdal.Geometry
-		unionGeo = gdal.Create(gdal.GT_Polygon)
-		gc       = []destroyable{unionGeo}
+		geo gdal.Geometry
+		u   = newCascadedUnion()
 	)
-	defer func() {
-		for _, v := range gc {
-			v.Destroy()
-		}
-	}()
+	defer u.Destroy()
 	for _, a := range gs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		if geo, err = g.parseWKB(a, ref); err != nil {
 			return
 		}
-		gc = append(gc, geo)
-		unionGeo = unionGeo.Union(geo)
-		gc = append(gc, unionGeo)
+		u.addDirectly(geo)
 	}
+	unionGeo := u.union()
+	defer unionGeo.Destroy()
 	ret, err = unionGeo.ToWKB()
 	return
 }
 
 // 获取多个WKB矢量面公共区
 func (g *GdalToolbox) Intersection(gs []GdalGeo, srid int) (ret GdalGeo, err error) {
+	return g.IntersectionContext(context.Background(), gs, srid)
+}
+
+// 获取多个WKB矢量面公共区（可通过ctx取消）
+func (g *GdalToolbox) IntersectionContext(ctx context.Context, gs []GdalGeo, srid int) (ret GdalGeo, err error) {
 	ref, err := g.getSridRef(srid)
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	var (
-		geo      gdal.Geometry
+		geos     = make([]gdal.Geometry, len(gs))
+		bounds   = make([]Bounds, len(gs))
 		interGeo = gdal.Create(gdal.GT_Polygon)
 		gc       = []destroyable{interGeo}
 	)
@@ -281,13 +379,25 @@ func (g *GdalToolbox) Intersection(gs []GdalGeo, srid int) (ret GdalGeo, err err
 			v.Destroy()
 		}
 	}()
-	for _, a := range gs {
-		if geo, err = g.parseWKB(a, ref); err != nil {
+	for i, a := range gs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if geos[i], err = g.parseWKB(a, ref); err != nil {
 			return
 		}
-		gc = append(gc, geo)
-		interGeo = interGeo.Intersection(geo)
-		gc = append(gc, interGeo)
+		gc = append(gc, geos[i])
+		bounds[i] = geoBounds(geos[i])
+	}
+	// 有任一矢量与第一个矢量的外包框不相交时，公共区必为空，无需逐个求交
+	if len(geos) > 0 && len(NewSpatialIndex(bounds).Query(bounds[0])) == len(geos) {
+		for _, geo := range geos {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			interGeo = interGeo.Intersection(geo)
+			gc = append(gc, interGeo)
+		}
 	}
 	ret, err = interGeo.ToWKB()
 	return
@@ -299,6 +409,7 @@ func (g *GdalToolbox) Difference(gA, gB GdalGeo, srid int) (ret GdalGeo, err err
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	geoA, err := g.parseWKB(gA, ref)
 	if err != nil {
 		return
@@ -317,30 +428,48 @@ func (g *GdalToolbox) Difference(gA, gB GdalGeo, srid int) (ret GdalGeo, err err
 
 // 从目标区域WKB中剪除多个其他区域WKB
 func (g *GdalToolbox) SubtractZones(uc *Uncertainty, subs []Uncertainty, srid int) (err error) {
+	return g.SubtractZonesContext(context.Background(), uc, subs, srid)
+}
+
+// 从目标区域WKB中剪除多个其他区域WKB（可通过ctx取消）
+func (g *GdalToolbox) SubtractZonesContext(ctx context.Context, uc *Uncertainty, subs []Uncertainty, srid int) (err error) {
 	ref, err := g.getSridRef(srid)
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	ucGeo, err := g.parseWKB(uc.Geom, ref)
 	if err != nil {
 		return
 	}
 	var (
-		geo gdal.Geometry
-		e   error
-		gc  = []destroyable{ucGeo}
+		geos   = make([]gdal.Geometry, len(subs))
+		bounds = make([]Bounds, len(subs))
+		e      error
+		gc     = []destroyable{ucGeo}
 	)
 	defer func() {
 		for _, v := range gc {
 			v.Destroy()
 		}
 	}()
-	for _, vec := range subs {
-		if geo, e = g.parseWKB(vec.Geom, ref); e != nil {
+	for i, vec := range subs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		bounds[i] = EmptyBounds
+		if geos[i], e = g.parseWKB(vec.Geom, ref); e != nil {
 			continue
 		}
-		gc = append(gc, geo)
-		ucGeo = ucGeo.Difference(geo)
+		gc = append(gc, geos[i])
+		bounds[i] = geoBounds(geos[i])
+	}
+	// 只剪除外包框与目标区域相交的区域
+	for _, i := range NewSpatialIndex(bounds).queryGeometry(ucGeo) {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		ucGeo = ucGeo.Difference(geos[i])
 		gc = append(gc, ucGeo)
 	}
 	uc.Geom, err = ucGeo.ToWKB()
@@ -353,6 +482,7 @@ func (g *GdalToolbox) GetWktSpan(wkt string, srid int) (span [4]float64, err err
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	geo, err := g.parseWKT(wkt, ref)
 	if err != nil {
 		return
@@ -1,11 +1,23 @@
 package gdalib
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/wgdzlh/gdalib/log"
+
 	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestReadMeteoTif(t *testing.T) {
@@ -97,3 +109,1349 @@ func TestTransIdxToLonLat(t *testing.T) {
 	lon, lat = Convert3857To4326(lon, lat)
 	t.Logf("%.10f,%.10f", lon, lat)
 }
+
+func TestUnionContextCanceled(t *testing.T) {
+	g := NewGdalToolbox()
+	wkb, err := g.WktToWkb("POLYGON((0 0,0 2,2 2,2 0,0 0))", 4326)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = g.UnionContext(ctx, []GdalGeo{wkb, wkb}, 4326); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+}
+
+func TestCascadedUnion25D(t *testing.T) {
+	u := newCascadedUnion()
+	defer u.Destroy()
+	for _, wkt := range []string{"POLYGON Z((0 0 1,0 2 1,2 2 1,2 0 1,0 0 1))", "MULTIPOLYGON Z(((1 0 1,1 2 1,3 2 1,3 0 1,1 0 1)))"} {
+		geo, err := gdal.CreateFromWKT(wkt, gdal.SpatialReference{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.add(geo)
+		geo.Destroy()
+	}
+	if len(u.others) != 0 || u.polygons.GeometryCount() != 2 {
+		t.Fatalf("25D polygons should be collected as polygons, others: %d", len(u.others))
+	}
+	ret := u.union()
+	defer ret.Destroy()
+	if flatType(ret) != gdal.GT_Polygon || ret.Area() != 6 {
+		t.Fatalf("unexpected union: %v, %v", ret.Type(), ret.Area())
+	}
+}
+
+func writeTestGeoJSON(t *testing.T) string {
+	src := filepath.Join(t.TempDir(), "parcels.geojson")
+	content := `{"type":"FeatureCollection","name":"parcels","features":[
+{"type":"Feature","properties":{"label":"paddy","code":101,"area":1.5},"geometry":{"type":"Polygon","coordinates":[[[0,0],[0,1],[1,1],[1,0],[0,0]]]}},
+{"type":"Feature","properties":{"label":"forest","code":202,"area":2.5},"geometry":{"type":"Polygon","coordinates":[[[1,0],[1,1],[2,1],[2,0],[1,0]]]}}]}`
+	if err := os.WriteFile(src, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestParseGeoJSONVector(t *testing.T) {
+	g := NewGdalToolbox()
+	src := writeTestGeoJSON(t)
+	sps, err := g.ParseShapefile(src, "label", WithLayerName("parcels"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sps) != 2 || sps[0].ClassName != "paddy" {
+		t.Fatalf("unexpected speckles: %+v", sps)
+	}
+	if _, err = g.ParseShapefile(src, "label", WithLayerIndex(1)); !errors.Is(err, ErrLayerNotFound) {
+		t.Fatalf("expect ErrLayerNotFound, got %v", err)
+	}
+}
+
+func TestFeatureReader(t *testing.T) {
+	g := NewGdalToolbox()
+	r, err := g.NewFeatureReader(writeTestGeoJSON(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var labels []string
+	for {
+		ft, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ft.Geom) == 0 {
+			t.Fatalf("feature %d has no geom", ft.FID)
+		}
+		labels = append(labels, ft.Attrs["label"].(string))
+		t.Log(ft.FID, ft.Attrs)
+	}
+	if len(labels) != 2 {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+}
+
+func TestSpeckleAttrsRoundTrip(t *testing.T) {
+	g := NewGdalToolbox()
+	sps, err := g.ParseShapefile(writeTestGeoJSON(t), "label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "parcels.shp")
+	if err = g.WriteShapefile(out, "label", 4326, sps...); err != nil {
+		t.Fatal(err)
+	}
+	back, err := g.ParseShapefile(out, "label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back) != len(sps) {
+		t.Fatalf("expect %d speckles, got %d", len(sps), len(back))
+	}
+	for i, sp := range back {
+		if sp.ClassName != sps[i].ClassName || sp.Attrs["code"] != sps[i].Attrs["code"] || sp.Attrs["area"] != sps[i].Attrs["area"] {
+			t.Fatalf("attrs not round-tripped: %+v vs %+v", sp.Attrs, sps[i].Attrs)
+		}
+	}
+}
+
+func TestWriteVectorFormats(t *testing.T) {
+	g := NewGdalToolbox()
+	sps, err := g.ParseShapefile(writeTestGeoJSON(t), "label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"parcels.gpkg", "parcels.geojson", "parcels.fgb", "parcels.csv"} {
+		out := filepath.Join(dir, name)
+		if err = g.WriteShapefile(out, "label", 4326, sps...); err != nil {
+			t.Fatal(name, err)
+		}
+		back, err := g.ParseShapefile(out, "label")
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if len(back) != len(sps) || back[0].ClassName != sps[0].ClassName {
+			t.Fatalf("%s: speckles not round-tripped", name)
+		}
+	}
+	out := filepath.Join(dir, "parcels.dat")
+	if err = g.WriteShapefileContext(context.Background(), out, "label", 4326, sps, WithFormat(FormatGeoJSON)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = g.ParseShapefile(out, "label"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictWriteRollback(t *testing.T) {
+	g := NewGdalToolbox()
+	dir := t.TempDir()
+	out := filepath.Join(dir, "strict.shp")
+	sps := []Speckle{
+		{ClassName: "ok", Geom: mustWkb(t, g, "POLYGON((0 0,1 0,1 1,0 1,0 0))")},
+		{ClassName: "bad", Geom: GdalGeo("not a wkb")},
+	}
+	err := g.WriteShapefileContext(context.Background(), out, "label", 4326, sps, WithStrict())
+	var we *WriteError
+	if !errors.As(err, &we) || !errors.Is(err, ErrPartialWrite) {
+		t.Fatalf("expect WriteError, got %v", err)
+	}
+	if len(we.Failures) != 1 || we.Failures[0].Index != 1 {
+		t.Fatalf("unexpected failures: %+v", we.Failures)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("strict write left %d files behind", len(entries))
+	}
+	if err = g.WriteShapefileContext(context.Background(), out, "label", 4326, sps[:1], WithStrict()); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{".shp", ".shx", ".dbf", ".prj", ".cpg"} {
+		if _, err = os.Stat(filepath.Join(dir, "strict"+ext)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func mustWkb(t *testing.T, g *GdalToolbox, wkt string) GdalGeo {
+	t.Helper()
+	wkb, err := g.WktToWkb(wkt, GEOJSON_SRID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wkb
+}
+
+func TestFieldError(t *testing.T) {
+	g := NewGdalToolbox()
+	src := writeTestGeoJSON(t)
+	_, err := g.ParseShapefile(src, "missing")
+	var fe *FieldError
+	if !errors.As(err, &fe) || !errors.Is(err, ErrColumnMissing) {
+		t.Fatalf("expect FieldError, got %v", err)
+	}
+	// 字段缺失并非GDAL调用出错，不应带有CPL错误信息
+	if fe.Path != src || fe.Layer != "parcels" || fe.Field != "missing" || fe.FID != -1 || fe.CPLMsg != "" {
+		t.Fatalf("unexpected field error: %+v", fe)
+	}
+	sps := []Speckle{{ClassName: "bad", Geom: GdalGeo("not a wkb")}}
+	out := filepath.Join(t.TempDir(), "bad.shp")
+	err = g.WriteShapefileContext(context.Background(), out, "label", 4326, sps, WithStrict())
+	var we *WriteError
+	if !errors.As(err, &we) {
+		t.Fatalf("expect WriteError, got %v", err)
+	}
+	var fte *FeatureError
+	if !errors.As(we.Failures[0].Err, &fte) || fte.FID != 0 || fte.Path != out {
+		t.Fatalf("expect FeatureError, got %v", we.Failures[0].Err)
+	}
+}
+
+func TestCPLErrorCaptured(t *testing.T) {
+	rec := newRecordLogger()
+	g := NewGdalToolbox(WithLogger(rec), WithCPLForward(true))
+	// 无效的目标坐标系使VectorTranslate失败
+	_, err := g.ShapefileToGeoJSON(writeTestGeoJSON(t), 999999)
+	var ce *CPLError
+	if !errors.As(err, &ce) || ce.Op != "VectorTranslate" {
+		t.Fatalf("expect CPLError, got %v", err)
+	}
+	if len(ce.Messages) == 0 || ce.failures() == "" {
+		t.Fatalf("expect captured gdal messages, got %+v", ce)
+	}
+	forwarded := false
+	for _, e := range *rec.entries {
+		if strings.HasSuffix(e["msg"].(string), "gdal error") && e["op"] == "VectorTranslate" {
+			forwarded = true
+		}
+	}
+	if !forwarded {
+		t.Fatalf("expect gdal error forwarded to logger, got %v", *rec.entries)
+	}
+}
+
+// 以下并发测试需配合 go test -race 运行
+const raceWorkers = 16
+
+func hammer(t *testing.T, fn func(i int) error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, raceWorkers)
+	for i := 0; i < raceWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(i); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentTransformWkb(t *testing.T) {
+	g := NewGdalToolbox()
+	wkb := mustWkb(t, g, "POLYGON((116 39,117 39,117 40,116 40,116 39))")
+	hammer(t, func(i int) error {
+		for j := 0; j < 50; j++ {
+			if _, err := g.TransformWkb(wkb, GEOJSON_SRID, []int{OUTPUT_SRID, WKT_ALG_SRID, 4547}[j%3]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestConcurrentUnion(t *testing.T) {
+	g := NewGdalToolbox()
+	gs := make([]GdalGeo, 20)
+	for i := range gs {
+		gs[i] = mustWkb(t, g, fmt.Sprintf("POLYGON((%d 0,%d 0,%d 1,%d 1,%d 0))", i, i+2, i+2, i, i))
+	}
+	hammer(t, func(i int) error {
+		for j := 0; j < 20; j++ {
+			if _, err := g.Union(gs, GEOJSON_SRID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func writeTestTif(t *testing.T, path string, minX, maxY float64) {
+	t.Helper()
+	driver, err := gdal.GetDriverByName("GTiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := driver.Create(path, 100, 100, 3, gdal.Byte, nil)
+	defer ds.Close()
+	ref := gdal.CreateSpatialReference("")
+	defer ref.Destroy()
+	if err = ref.FromEPSG(GEOJSON_SRID); err != nil {
+		t.Fatal(err)
+	}
+	wkt, _ := ref.ToWKT()
+	ds.SetProjection(wkt)
+	ds.SetGeoTransform([6]float64{minX, 0.01, 0, maxY, 0, -0.01})
+	for i := 1; i <= 3; i++ {
+		ds.RasterBand(i).Fill(float64(i*50), 0)
+	}
+}
+
+func TestConcurrentCropRasters(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGdalToolbox(WithTmpDir(dir))
+	var files []ImgMergeFile
+	for i := 0; i < 2; i++ {
+		tif := filepath.Join(dir, fmt.Sprintf("img_%d.tif", i))
+		minX := 116 + 0.5*float64(i)
+		writeTestTif(t, tif, minX, 40)
+		files = append(files, ImgMergeFile{
+			Infile:    tif,
+			BandOrder: "R,G,B",
+			Wkb:       mustWkb(t, g, fmt.Sprintf("POLYGON((%[1]f 39,%[2]f 39,%[2]f 40,%[1]f 40,%[1]f 39))", minX, minX+1)),
+		})
+	}
+	hammer(t, func(i int) error {
+		out := filepath.Join(dir, fmt.Sprintf("out_%d.tif", i))
+		return g.CropRasters(files, "POLYGON((116.2 39.2,117.2 39.2,117.2 39.8,116.2 39.8,116.2 39.2))", out)
+	})
+}
+
+func TestTransformWkbBatch(t *testing.T) {
+	g := NewGdalToolbox()
+	wkts := make([]string, 100)
+	for i := range wkts {
+		wkts[i] = fmt.Sprintf("POINT(%d %d)", 100+i%20, 20+i%10)
+	}
+	wkts[42] = "POINT(broken"
+	gs, err := g.WktToWkbBatch(wkts, GEOJSON_SRID, 4)
+	var be *BatchError
+	if !errors.As(err, &be) || len(be.Failures) != 1 || be.Failures[0].Index != 42 || !errors.Is(be.Failures[0].Err, ErrInvalidWKT) {
+		t.Fatalf("expect one failure at 42, got %v", err)
+	}
+	gs = append(gs[:42], gs[43:]...)
+	rets, err := g.TransformWkbBatch(gs, GEOJSON_SRID, WKT_ALG_SRID, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, wkb := range gs {
+		want, err := g.TransformWkb(wkb, GEOJSON_SRID, WKT_ALG_SRID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(want) != string(rets[i]) {
+			t.Fatalf("result %d out of order", i)
+		}
+	}
+}
+
+// 生成n*n个相互略有重叠的方格面
+func polygonGrid(tb testing.TB, g *GdalToolbox, n int) (gs []GdalGeo) {
+	gs = make([]GdalGeo, 0, n*n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			x0, y0 := 100+float64(i)*0.01, 30+float64(j)*0.01
+			x1, y1 := x0+0.011, y0+0.011
+			wkb, err := g.WktToWkb(fmt.Sprintf("POLYGON((%[1]f %[2]f,%[3]f %[2]f,%[3]f %[4]f,%[1]f %[4]f,%[1]f %[2]f))", x0, y0, x1, y1), GEOJSON_SRID)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			gs = append(gs, wkb)
+		}
+	}
+	return
+}
+
+// 逐个合并（旧实现），作为基准对照
+func unionPairwise(g *GdalToolbox, gs []GdalGeo) (ret GdalGeo, err error) {
+	ref, err := g.getSridRef(GEOJSON_SRID)
+	if err != nil {
+		return
+	}
+	defer ref.Release()
+	unionGeo := gdal.Create(gdal.GT_Polygon)
+	for _, a := range gs {
+		geo, err := g.parseWKB(a, ref)
+		if err != nil {
+			return nil, err
+		}
+		next := unionGeo.Union(geo)
+		unionGeo.Destroy()
+		geo.Destroy()
+		unionGeo = next
+	}
+	defer unionGeo.Destroy()
+	return unionGeo.ToWKB()
+}
+
+func TestUnionCascaded(t *testing.T) {
+	g := NewGdalToolbox()
+	gs := polygonGrid(t, g, 10)
+	wkb, err := g.Union(gs, GEOJSON_SRID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	area, err := g.GetAreaCoverageRatio("POLYGON((100 30,100.101 30,100.101 30.101,100 30.101,100 30))", []string{mustWkt(t, g, wkb)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area < 0.9999 {
+		t.Fatalf("union should cover the grid, got ratio %f", area)
+	}
+}
+
+func mustWkt(t *testing.T, g *GdalToolbox, wkb GdalGeo) string {
+	t.Helper()
+	wkt, err := g.WkbToWkt(wkb, GEOJSON_SRID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wkt
+}
+
+func BenchmarkUnionCascaded(b *testing.B) {
+	g := NewGdalToolbox()
+	gs := polygonGrid(b, g, 40)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Union(gs, GEOJSON_SRID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnionPairwise(b *testing.B) {
+	g := NewGdalToolbox()
+	gs := polygonGrid(b, g, 40)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := unionPairwise(g, gs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSpatialIndexQuery(t *testing.T) {
+	bounds := make([]Bounds, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		x, y := float64(i%37)*1.3, float64(i/37)*0.7
+		bounds = append(bounds, Bounds{x, y, x + float64(i%5), y + float64(i%3)})
+	}
+	bounds[500] = EmptyBounds
+	idx := NewSpatialIndex(bounds)
+	if idx.Len() != 999 {
+		t.Fatalf("expect 999 items, got %d", idx.Len())
+	}
+	for _, q := range []Bounds{{0, 0, 1, 1}, {10, 5, 20, 8}, {-5, -5, -1, -1}, {0, 0, 100, 100}} {
+		var want []int
+		for i, b := range bounds {
+			if !b.IsEmpty() && b.Intersects(q) {
+				want = append(want, i)
+			}
+		}
+		got := idx.Query(q)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("query %v: expect %v, got %v", q, want, got)
+		}
+	}
+}
+
+func TestIntersectionAndSubtract(t *testing.T) {
+	g := NewGdalToolbox()
+	gs := []GdalGeo{
+		mustWkb(t, g, "POLYGON((0 0,2 0,2 2,0 2,0 0))"),
+		mustWkb(t, g, "POLYGON((1 1,3 1,3 3,1 3,1 1))"),
+	}
+	// 外包框预筛选不改变结果：与原实现一致，从空面开始逐个求交
+	inter, err := g.Intersection(gs, GEOJSON_SRID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wkt := mustWkt(t, g, inter); !strings.HasSuffix(wkt, "EMPTY") {
+		t.Fatalf("expect empty as before, got %s", wkt)
+	}
+	gs = append(gs, mustWkb(t, g, "POLYGON((10 10,11 10,11 11,10 11,10 10))"))
+	if inter, err = g.Intersection(gs, GEOJSON_SRID); err != nil {
+		t.Fatal(err)
+	}
+	if wkt := mustWkt(t, g, inter); wkt != "POLYGON EMPTY" {
+		t.Fatalf("expect empty, got %s", wkt)
+	}
+	uc := &Uncertainty{Geom: gs[0]}
+	subs := []Uncertainty{{Geom: gs[1]}, {Geom: gs[2]}}
+	if err = g.SubtractZones(uc, subs, GEOJSON_SRID); err != nil {
+		t.Fatal(err)
+	}
+	ratio, err := g.GetAreaCoverageRatio("POLYGON((0 0,2 0,2 2,0 2,0 0))", []string{mustWkt(t, g, uc.Geom)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ratio < 0.7499 || ratio > 0.7501 {
+		t.Fatalf("expect 3/4 of the square left, got %f", ratio)
+	}
+}
+
+func TestValidateAndRepairGeometry(t *testing.T) {
+	g := NewGdalToolbox()
+	bowTie := "POLYGON((0 0,2 2,2 0,0 2,0 0))"
+	v, err := g.ValidateWkt(bowTie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Valid || v.Reason != ReasonSelfIntersection || fmt.Sprint(v.Location) != "[1 1]" {
+		t.Fatalf("unexpected validity: %+v", v)
+	}
+	v, err = g.ValidateWkt("POLYGON((0 0,0 1,1 1,1 1,1 0,0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Valid || len(v.Warnings) != 2 {
+		t.Fatalf("expect valid with duplicate/orientation warnings: %+v", v)
+	}
+	// 25D面（如PolygonZ的shp）同样检查并修复
+	dupZ := "POLYGON Z((0 0 1,0 1 1,1 1 1,1 1 1,1 0 1,0 0 1))"
+	if v, err = g.ValidateWkt(dupZ); err != nil || !v.Valid || len(v.Warnings) != 2 {
+		t.Fatalf("expect 25D polygon with duplicate/orientation warnings: %+v, %v", v, err)
+	}
+	fixedZ, err := g.RepairWkt(dupZ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err = g.ValidateWkt(fixedZ); err != nil || !v.Valid || len(v.Warnings) != 0 {
+		t.Fatalf("repaired 25D polygon still has warnings: %s, %+v, %v", fixedZ, v, err)
+	}
+	for _, geom := range [][]byte{
+		[]byte(bowTie),
+		mustWkb(t, g, bowTie),
+		[]byte(`{"type":"Polygon","coordinates":[[[0,0],[2,2],[2,0],[0,2],[0,0]]]}`),
+	} {
+		fixed, err := g.RepairGeometry(geom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detectGeomFormat(fixed) != detectGeomFormat(geom) {
+			t.Fatalf("format changed: %s", fixed)
+		}
+		if v, err = g.ValidateGeometry(fixed); err != nil || !v.Valid || len(v.Warnings) != 0 {
+			t.Fatalf("repaired geometry still invalid: %+v, %v", v, err)
+		}
+	}
+}
+
+func TestParseShapefileWithRepair(t *testing.T) {
+	g := NewGdalToolbox()
+	src := filepath.Join(t.TempDir(), "bowtie.geojson")
+	if err := os.WriteFile(src, []byte(`{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"label":"a"},"geometry":{"type":"Polygon","coordinates":[[[0,0],[2,2],[2,0],[0,2],[0,0]]]}}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sps, err := g.ParseShapefile(src, "label", WithRepair())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sps) != 1 {
+		t.Fatalf("expect 1 speckle, got %d", len(sps))
+	}
+	if v, err := g.ValidateGeometry(sps[0].Geom); err != nil || !v.Valid {
+		t.Fatalf("expect repaired geometry: %+v, %v", v, err)
+	}
+}
+
+// CGCS2000 3度带高斯克吕格投影（中央经线117°，不带带号），ESRI格式，无AUTHORITY节点
+const testEsriGK117 = `PROJCS["CGCS2000_3_Degree_GK_CM_117E",GEOGCS["GCS_China_Geodetic_Coordinate_System_2000",DATUM["D_China_2000",SPHEROID["CGCS2000",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Gauss_Kruger"],PARAMETER["False_Easting",500000.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",117.0],PARAMETER["Scale_Factor",1.0],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`
+
+func TestCRSDefinitions(t *testing.T) {
+	g := NewGdalToolbox()
+	srid, err := g.IdentifyEPSG(testEsriGK117)
+	if err != nil || srid != 4548 {
+		t.Fatalf("expect 4548, got %d, %v", srid, err)
+	}
+	wkt := "POINT (117 30)"
+	byCode, err := g.TransformWktCRS(wkt, EPSG(4490), EPSG(4548))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dst := range []CRS{testEsriGK117, "+proj=tmerc +lat_0=0 +lon_0=117 +k=1 +x_0=500000 +y_0=0 +ellps=GRS80 +units=m +no_defs"} {
+		ret, err := g.TransformWktCRS(wkt, EPSG(4490), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var x0, y0, x1, y1 float64
+		fmt.Sscanf(byCode, "POINT (%g %g)", &x0, &y0)
+		fmt.Sscanf(ret, "POINT (%g %g)", &x1, &y1)
+		if math.Abs(x1-x0) > 1e-3 || math.Abs(y1-y0) > 1e-3 {
+			t.Fatalf("expect %s, got %s", byCode, ret)
+		}
+	}
+	if _, err = g.TransformWktCRS(wkt, EPSG(4490), "not a crs"); !errors.Is(err, ErrInvalidCRS) {
+		t.Fatalf("expect ErrInvalidCRS, got %v", err)
+	}
+	// 带AUTHORITY节点的WKT直接取根节点编码（而非GEOGCS节点中的4490）
+	ref, err := g.getSridRef(4548)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Release()
+	if srid, how, err := g.identifySrid(ref); err != nil || srid != 4548 || how != "authority" {
+		t.Fatalf("expect 4548 by authority, got %d by %s, %v", srid, how, err)
+	}
+	authWkt, _ := ref.ToWKT()
+	if srid, err = g.IdentifyEPSG(CRS(authWkt)); err != nil || srid != 4548 {
+		t.Fatalf("expect 4548, got %d, %v", srid, err)
+	}
+	// 只缓存EPSG坐标系，WKT、PROJ等定义不进入缓存
+	if len(g.refMap) != 2 || g.refMap[4490] == (gdal.SpatialReference{}) || g.refMap[4548] == (gdal.SpatialReference{}) {
+		t.Fatalf("unexpected crs cache: %v", g.refMap)
+	}
+}
+
+func TestInferCGCS2000GK(t *testing.T) {
+	for _, c := range []struct {
+		b    Bounds
+		cm   float64
+		srid int
+	}{
+		{Bounds{39400000, 3300000, 39600000, 3400000}, 0, 4527},   // 3度带39带，带前缀
+		{Bounds{20300000, 3300000, 20700000, 3400000}, 0, 4497},   // 6度带20带，带前缀
+		{Bounds{420000, 3300000, 580000, 3400000}, 117, 4548},     // 3度带中央经线117°
+		{Bounds{420000, 3300000, 580000, 3400000}, 111, 4546},     // 中央经线111°同为6度带中央经线，按3度带
+		{Bounds{200000, 3300000, 780000, 3400000}, 111, 4508},     // 东坐标跨度超出3度带，按6度带
+		{Bounds{420000, 3300000, 580000, 3400000}, 0, 0},          // 无带号且无中央经线
+		{Bounds{113.5, 22.5, 114.5, 23.5}, 0, 0},                  // 经纬度
+		{Bounds{24400000, 3300000, 24600000, 3400000}, 0, 0},      // 无效带号
+		{Bounds{420000, 3300000, 580000, 3400000}, 116, 0},        // 无效中央经线
+		{Bounds{39400000, 3300000, 40600000, 3400000}, 0, 0},      // 跨带
+		{Bounds{39400000, -3300000, 39600000, 3400000}, 0, 0},     // 南半球
+		{Bounds{39400000, 3300000, 39600000, 3400000}, 117, 4527}, // 带前缀时以带号为准
+	} {
+		srid, err := InferCGCS2000GK(c.b, c.cm)
+		if c.srid == 0 {
+			if !errors.Is(err, ErrGKZoneUnknown) {
+				t.Errorf("%+v: expect ErrGKZoneUnknown, got %d, %v", c.b, srid, err)
+			}
+			continue
+		}
+		if err != nil || srid != c.srid {
+			t.Errorf("%+v: expect %d, got %d, %v", c.b, c.srid, srid, err)
+		}
+	}
+}
+
+func TestGetWkbFromShpWithoutPrj(t *testing.T) {
+	g := NewGdalToolbox()
+	shp := filepath.Join(t.TempDir(), "noprj.shp")
+	ds, ok := gdal.OGRDriverByName(SHP_DRIVER_NAME).Create(shp, nil)
+	if !ok {
+		t.Fatal("create shp failed")
+	}
+	layer := ds.CreateLayer("noprj", gdal.SpatialReference{}, gdal.GT_Polygon, nil)
+	geo, err := gdal.CreateFromWKT("POLYGON ((39400000 3300000,39600000 3300000,39600000 3400000,39400000 3400000,39400000 3300000))", gdal.SpatialReference{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feature := layer.Definition().Create()
+	feature.SetGeometryDirectly(geo)
+	if err = layer.Create(feature); err != nil {
+		t.Fatal(err)
+	}
+	feature.Destroy()
+	ds.Destroy()
+
+	if srid, err := g.InferShapefileCRS(shp); err != nil || srid != 4527 {
+		t.Fatalf("expect 4527, got %d, %v", srid, err)
+	}
+	wkb, err := g.GetWkbFromShp(shp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := WkbBounds(wkb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 39带中央经线117°
+	if b.MinX < 115.5 || b.MaxX > 118.5 || b.MinY < 29 || b.MaxY > 31 {
+		t.Fatalf("unexpected lon/lat bounds: %+v", b)
+	}
+}
+
+func TestLonLatOffset(t *testing.T) {
+	near := func(x0, y0, x1, y1, tol float64) bool {
+		return math.Abs(x0-x1) < tol && math.Abs(y0-y1) < tol
+	}
+	if x, y := ConvertWgs84ToGcj02(116.404, 39.915); !near(x, y, 116.41024449916938, 39.91640428150164, 1e-8) {
+		t.Fatalf("wgs84 -> gcj02: %v %v", x, y)
+	}
+	if x, y := ConvertGcj02ToBd09(116.404, 39.915); !near(x, y, 116.41036949371029, 39.92133699351021, 1e-8) {
+		t.Fatalf("gcj02 -> bd09: %v %v", x, y)
+	}
+	if x, y := ConvertWgs84ToGcj02(2.35, 48.85); x != 2.35 || y != 48.85 {
+		t.Fatalf("expect no offset out of China: %v %v", x, y)
+	}
+	systems := []LonLatSystem{CoordWGS84, CoordGCJ02, CoordBD09}
+	for _, from := range systems {
+		for _, to := range systems {
+			x, y := ConvertLonLat(113.95, 22.54, from, to)
+			if x, y = ConvertLonLat(x, y, to, from); !near(x, y, 113.95, 22.54, 1e-9) {
+				t.Fatalf("round trip %d -> %d: %v %v", from, to, x, y)
+			}
+		}
+	}
+
+	g := NewGdalToolbox()
+	wkt := "POLYGON ((113.9 22.5,114.0 22.5,114.0 22.6,113.9 22.5))"
+	gcj, err := g.ConvertWkt(wkt, CoordWGS84, CoordGCJ02)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x1, y1 float64
+	fmt.Sscanf(gcj, "POLYGON ((%g %g", &x1, &y1)
+	if x0, y0 := ConvertWgs84ToGcj02(113.9, 22.5); !near(x0, y0, x1, y1, 1e-9) {
+		t.Fatalf("unexpected gcj02 polygon: %s", gcj)
+	}
+	geoJSON, err := g.ConvertGeometry([]byte(`{"type":"Point","coordinates":[113.9,22.5]}`), CoordWGS84, CoordBD09)
+	if err != nil || !strings.HasPrefix(string(geoJSON), "{") {
+		t.Fatalf("expect GeoJSON output, got %s, %v", geoJSON, err)
+	}
+	if _, err = g.ConvertWkt(wkt, CoordWGS84, LonLatSystem(9)); !errors.Is(err, ErrLonLatSystem) {
+		t.Fatalf("expect ErrLonLatSystem, got %v", err)
+	}
+}
+
+func TestGeodesicAreaAndLength(t *testing.T) {
+	g := NewGdalToolbox()
+	// 经纬度1°×1°格网（沿纬线加密），与椭球面梯形面积解析值比较
+	var sb strings.Builder
+	sb.WriteString("POLYGON ((")
+	for i := 0; i <= 100; i++ {
+		fmt.Fprintf(&sb, "%g 60,", 110+float64(i)/100)
+	}
+	for i := 100; i >= 0; i-- {
+		fmt.Fprintf(&sb, "%g 61,", 110+float64(i)/100)
+	}
+	sb.WriteString("110 60))")
+	area, err := g.GeodesicArea([]byte(sb.String()), UNIVERSAL_SRID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(area-6.1231e9)/6.1231e9 > 1e-4 {
+		t.Fatalf("unexpected area: %f", area)
+	}
+	// Vincenty算例：Flinders Peak -> Buninyong
+	length, err := g.GeodesicLength([]byte("LINESTRING (144.42486788 -37.95103342,143.92649554 -37.65282114)"), UNIVERSAL_SRID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(length-54972.271) > 0.01 {
+		t.Fatalf("unexpected length: %f", length)
+	}
+	// 投影坐标系下按其地理坐标系计算，与平面面积（高斯投影面积变形很小）接近
+	wkb := mustWkb(t, g, "POLYGON ((117 30,118 30,118 31,117 31,117 30))")
+	gk, err := g.TransformWkb(wkb, GEOJSON_SRID, 4548)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1, err := g.GeodesicArea(gk, 4548)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := g.GeodesicArea(wkb, GEOJSON_SRID)
+	if err != nil || math.Abs(a1-a2)/a2 > 1e-6 {
+		t.Fatalf("expect same area: %f, %f, %v", a1, a2, err)
+	}
+	t.Logf("area %.0f m² = %.2f 亩 = %.2f 公顷", a2, a2/SQ_METERS_PER_MU, a2/SQ_METERS_PER_HECTARE)
+
+	// 高纬度区域覆盖率：平面面积与椭球面面积的结果不同
+	district := "POLYGON ((100 50,101 50,101 70,100 70,100 50))"
+	images := []string{"POLYGON ((100 60,101 60,101 70,100 70,100 60))"}
+	planar, err := g.GetAreaCoverageRatio(district, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geodesic, err := g.GetAreaCoverageRatio(district, images, WithGeodesicArea())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if planar != 0.5 || geodesic >= 0.45 {
+		t.Fatalf("unexpected ratios: planar %f, geodesic %f", planar, geodesic)
+	}
+}
+
+func TestProcessZoneMergeMeters(t *testing.T) {
+	g := NewGdalToolbox()
+	uc := &Uncertainty{Id: 1, Geom: mustWkb(t, g, "POLYGON ((100 60,100.001 60,100.001 60.001,100 60.001,100 60))")}
+	ret, err := g.ProcessZoneMerge(uc, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo := gdal.CreateFromJson(string(ret))
+	defer geo.Destroy()
+	b := geoBounds(geo)
+	// 60°N处1000米约合纬度0.009°、经度0.018°，按米缓冲时经纬向外扩量应不同
+	dLon, dLat := 100-b.MinX, 60-b.MinY
+	if math.Abs(dLat-0.009) > 0.0005 || math.Abs(dLon-0.018) > 0.001 {
+		t.Fatalf("unexpected buffer extent: dLon %f, dLat %f", dLon, dLat)
+	}
+	ret, err = g.ProcessZoneMergeBuffer(uc, 0.01, BufferCRSUnits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo2 := gdal.CreateFromJson(string(ret))
+	defer geo2.Destroy()
+	if b = geoBounds(geo2); math.Abs(100-b.MinX-0.01) > 1e-4 || math.Abs(60-b.MinY-0.01) > 1e-4 {
+		t.Fatalf("unexpected crs unit buffer extent: %+v", b)
+	}
+}
+
+func TestToolboxOptions(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGdalToolbox(WithTmpDir(dir), WithOutputSrid(GEOJSON_SRID), WithCoverageThreshold(0.4))
+	uc := Uncertainty{Id: 1, Geom: mustWkb(t, g, "POLYGON ((100 30,101 30,101 31,100 31,100 30))")}
+	shp := filepath.Join(dir, "merged.shp")
+	if err := g.WriteMergedShapefile(shp, uc); err != nil {
+		t.Fatal(err)
+	}
+	if srid, err := g.GetSridOfShapefile(shp); err != nil || srid != GEOJSON_SRID {
+		t.Fatalf("expect output srid %d, got %d, %v", GEOJSON_SRID, srid, err)
+	}
+	// 覆盖率0.5高于阈值0.4，不输出未覆盖区域
+	half := mustWkb(t, g, "POLYGON ((100 30,100.5 30,100.5 31,100 31,100 30))")
+	ratios, _, _, diffs, err := g.GetAreaCoverage(uc.Geom, []GdalGeo{half})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ratios[0] != 0.5 || diffs[0] != nil {
+		t.Fatalf("unexpected coverage: %v, %s", ratios, diffs[0])
+	}
+	if ratios, _, _, diffs, err = NewGdalToolbox().GetAreaCoverage(uc.Geom, []GdalGeo{half}); err != nil || diffs[0] == nil {
+		t.Fatalf("expect diff with default threshold: %v, %v", ratios, err)
+	}
+	if c := NewGdalToolboxWithTmpDir(dir, WithOutputSrid(GEOJSON_SRID)); c.tmpDir != dir || c.outputSrid != GEOJSON_SRID {
+		t.Fatalf("unexpected compat toolbox: %s, %d", c.tmpDir, c.outputSrid)
+	}
+}
+
+// 记录日志条目及其字段的Logger
+type recordLogger struct {
+	mu      *sync.Mutex
+	fields  []zap.Field
+	entries *[]map[string]interface{}
+}
+
+func newRecordLogger() recordLogger {
+	return recordLogger{mu: &sync.Mutex{}, entries: &[]map[string]interface{}{}}
+}
+
+func (r recordLogger) record(msg string, fields []zap.Field) {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range append(r.fields[:len(r.fields):len(r.fields)], fields...) {
+		f.AddTo(enc)
+	}
+	enc.Fields["msg"] = msg
+	r.mu.Lock()
+	*r.entries = append(*r.entries, enc.Fields)
+	r.mu.Unlock()
+}
+
+func (r recordLogger) Debug(msg string, fields ...zap.Field) { r.record(msg, fields) }
+func (r recordLogger) Info(msg string, fields ...zap.Field)  { r.record(msg, fields) }
+func (r recordLogger) Warn(msg string, fields ...zap.Field)  { r.record(msg, fields) }
+func (r recordLogger) Error(msg string, fields ...zap.Field) { r.record(msg, fields) }
+func (r recordLogger) With(fields ...zap.Field) log.Logger {
+	r.fields = append(r.fields[:len(r.fields):len(r.fields)], fields...)
+	return r
+}
+
+func TestToolboxLogger(t *testing.T) {
+	rec := newRecordLogger()
+	g := NewGdalToolbox(WithLogger(rec))
+	if _, err := g.With(zap.String("reqId", "r1")).GetSridOfShapefile("/not/exist.shp"); err == nil {
+		t.Fatal("expect open error")
+	}
+	if len(*rec.entries) == 0 {
+		t.Fatal("expect logs routed to custom logger")
+	}
+	for _, e := range *rec.entries {
+		if e["reqId"] != "r1" {
+			t.Fatalf("expect reqId field in every entry: %v", e)
+		}
+	}
+	// 派生工具箱不影响原工具箱
+	n := len(*rec.entries)
+	g.GetSridOfShapefile("/not/exist.shp")
+	for _, e := range (*rec.entries)[n:] {
+		if _, ok := e["reqId"]; ok {
+			t.Fatalf("unexpected reqId field: %v", e)
+		}
+	}
+	// 包级日志（utils等）可整体替换
+	pkg := newRecordLogger()
+	log.SetLogger(pkg)
+	defer log.SetLogger(nil)
+	NewGdalToolbox().GetSridOfShapefile("/not/exist.shp")
+	if len(*pkg.entries) == 0 {
+		t.Fatal("expect logs routed to package logger")
+	}
+	NewGdalToolbox(WithLogger(log.Nop())).GetSridOfShapefile("/not/exist.shp")
+}
+
+// 生成单波段测试影像（4x3，坐标系4490），像元值为其序号，第0个像元为无效值
+func writeTypedTif(t *testing.T, path string, dt gdal.DataType, noData, scale, offset float64, createOpts ...string) {
+	t.Helper()
+	driver, err := gdal.GetDriverByName("GTiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := driver.Create(path, 4, 3, 1, dt, createOpts)
+	defer ds.Close()
+	ref := gdal.CreateSpatialReference("")
+	defer ref.Destroy()
+	if err = ref.FromEPSG(OUTPUT_SRID); err != nil {
+		t.Fatal(err)
+	}
+	wkt, _ := ref.ToWKT()
+	ds.SetProjection(wkt)
+	ds.SetGeoTransform([6]float64{110, 0.5, 0, 40, 0, -0.5})
+	band := ds.RasterBand(1)
+	band.SetNoDataValue(noData)
+	band.SetScale(scale)
+	band.SetOffset(offset)
+	buf := make([]float64, 12)
+	for i := range buf {
+		buf[i] = float64(i)
+	}
+	buf[0] = noData
+	if err = band.IO(gdal.Write, 0, 0, 4, 3, buf, 4, 3, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadRasterTyped(t *testing.T) {
+	g := NewGdalToolbox()
+	dir := t.TempDir()
+	ndvi := filepath.Join(dir, "ndvi.tif")
+	writeTypedTif(t, ndvi, gdal.Float32, -9999.9, 0.5, 1)
+	r, err := ReadRaster[float32](g, ndvi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.XSize != 4 || r.YSize != 3 || r.Srid != OUTPUT_SRID || r.CRS != EPSG(OUTPUT_SRID) || r.GeoTransform != [6]float64{110, 0.5, 0, 40, 0, -0.5} {
+		t.Fatalf("unexpected raster info: %+v", r.RasterInfo)
+	}
+	b := r.Bands[0]
+	if b.DataType != gdal.Float32 || !b.HasNoData || b.Scale != 0.5 || b.Offset != 1 {
+		t.Fatalf("unexpected band info: %+v", b)
+	}
+	if _, ok := r.Value(0, 0, 0); ok {
+		t.Fatal("expect nodata at (0, 0)")
+	}
+	if v, ok := r.Value(0, 1, 2); !ok || v != 9*0.5+1 {
+		t.Fatalf("unexpected value at (1, 2): %v, %v", v, ok)
+	}
+	if vs := r.Values(0); !math.IsNaN(vs[0]) || vs[11] != 11*0.5+1 {
+		t.Fatalf("unexpected values: %v", vs)
+	}
+
+	dem := filepath.Join(dir, "dem.tif")
+	writeTypedTif(t, dem, gdal.Int16, -32768, 1, 0)
+	info, bands, err := g.GetRasterInfo(dem)
+	if err != nil || info.BandCount != 1 || bands[0].DataType != gdal.Int16 {
+		t.Fatalf("unexpected info: %+v, %+v, %v", info, bands, err)
+	}
+	r16, err := ReadRaster[int16](g, dem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r16.Data[0][0] != -32768 || r16.Data[0][5] != 5 {
+		t.Fatalf("unexpected int16 data: %v", r16.Data[0])
+	}
+	// 按其他类型读取时由GDAL转换
+	r64, err := ReadRaster[float64](g, dem, 1)
+	if err != nil || r64.Data[0][5] != 5 {
+		t.Fatalf("unexpected float64 data: %v, %v", r64, err)
+	}
+	if _, err = ReadRaster[uint16](g, dem, 2); !errors.Is(err, ErrWrongTif) {
+		t.Fatalf("expect ErrWrongTif, got %v", err)
+	}
+}
+
+func TestReadRasterNoDataConversion(t *testing.T) {
+	g := NewGdalToolbox()
+	dir := t.TempDir()
+	// 超出整数类型取值范围的无效值按GDAL截断后的值比较
+	tif := filepath.Join(dir, "f32.tif")
+	writeTypedTif(t, tif, gdal.Float32, -3.4e38, 1, 0)
+	r16, err := ReadRaster[int16](g, tif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r16.Value(0, 0, 0); ok || r16.Data[0][0] != math.MinInt16 {
+		t.Fatalf("expect clamped nodata at (0, 0), got %v", r16.Data[0][0])
+	}
+	if v, ok := r16.Value(0, 1, 0); !ok || v != 1 {
+		t.Fatalf("unexpected value at (1, 0): %v, %v", v, ok)
+	}
+	r8, err := ReadRaster[uint8](g, tif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r8.Value(0, 0, 0); ok {
+		t.Fatal("expect nodata at (0, 0)")
+	}
+	// NaN无效值对整数类型不匹配任何像元
+	nan := filepath.Join(dir, "nan.tif")
+	writeTypedTif(t, nan, gdal.Float32, math.NaN(), 1, 0)
+	if r16, err = ReadRaster[int16](g, nan); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := r16.Value(0, 1, 0); !ok || v != 1 {
+		t.Fatalf("unexpected value at (1, 0): %v, %v", v, ok)
+	}
+	if rf, err := ReadRaster[float32](g, nan); err != nil || !math.IsNaN(rf.Values(0)[0]) {
+		t.Fatalf("expect NaN nodata at (0, 0): %v", err)
+	}
+}
+
+// 自定义中央经线的CGCS2000横轴墨卡托投影，无对应EPSG编码，但名称中含CGCS_2000
+const testCustomCGCS2000TM = `PROJCS["CGCS_2000_Custom_TM",GEOGCS["China Geodetic Coordinate System 2000",DATUM["China_2000",SPHEROID["CGCS2000",6378137,298.257222101]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],PARAMETER["latitude_of_origin",0],PARAMETER["central_meridian",117.3],PARAMETER["scale_factor",1],PARAMETER["false_easting",123456],PARAMETER["false_northing",0],UNIT["metre",1]]`
+
+func TestRasterInfoCRS(t *testing.T) {
+	g := NewGdalToolbox()
+	dir := t.TempDir()
+	driver, err := gdal.GetDriverByName("GTiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, crs CRS) string {
+		ref, err := g.getCRSRef(crs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ref.Release()
+		wkt, _ := ref.ToWKT()
+		path := filepath.Join(dir, name)
+		ds := driver.Create(path, 2, 2, 1, gdal.Byte, nil)
+		ds.SetProjection(wkt)
+		ds.SetGeoTransform([6]float64{500000, 10, 0, 4000000, 0, -10})
+		ds.Close()
+		return path
+	}
+	// 按名称只能推断出地理坐标系4490，不可替代投影坐标系
+	info, _, err := g.GetRasterInfo(write("custom.tif", testCustomCGCS2000TM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Srid != 0 || info.CRS == EPSG(4490) || !strings.Contains(string(info.CRS), "CGCS_2000_Custom_TM") {
+		t.Fatalf("expect wkt crs without srid, got %d, %s", info.Srid, info.CRS)
+	}
+	if info, _, err = g.GetRasterInfo(write("gk.tif", EPSG(4548))); err != nil || info.Srid != 4548 || info.CRS != EPSG(4548) {
+		t.Fatalf("expect EPSG:4548, got %+v, %v", info, err)
+	}
+}
+
+func TestReadRasterWindowAndBlocks(t *testing.T) {
+	g := NewGdalToolbox()
+	tif := filepath.Join(t.TempDir(), "strip.tif")
+	writeTypedTif(t, tif, gdal.Int16, -1, 1, 0, "BLOCKYSIZE=1")
+	w, err := ReadRasterWindow[int16](g, tif, Window{1, 1, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.XSize != 2 || w.YSize != 2 || fmt.Sprint(w.Data[0]) != "[5 6 9 10]" || w.GeoTransform[0] != 110.5 || w.GeoTransform[3] != 39.5 {
+		t.Fatalf("unexpected window: %+v", w)
+	}
+	if _, err = ReadRasterWindow[int16](g, tif, Window{3, 0, 2, 1}); !errors.Is(err, ErrWrongRasterOffset) {
+		t.Fatalf("expect ErrWrongRasterOffset, got %v", err)
+	}
+	// 范围超出影像的部分被裁剪，恰好落在像元边界上时不多取
+	b, err := ReadRasterBounds[int16](g, tif, Bounds{MinX: 109, MinY: 38, MaxX: 111, MaxY: 39})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Window != (Window{0, 2, 2, 1}) || fmt.Sprint(b.Data[0]) != "[8 9]" {
+		t.Fatalf("unexpected bounds read: %+v", b)
+	}
+	if _, err = ReadRasterBounds[int16](g, tif, Bounds{MinX: 120, MinY: 30, MaxX: 121, MaxY: 31}); !errors.Is(err, ErrWrongRasterOffset) {
+		t.Fatalf("expect ErrWrongRasterOffset, got %v", err)
+	}
+	r, err := NewBlockReader[int16](g, tif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if x, y := r.BlockSize(); x != 4 || y != 1 || r.BlockCount() != 3 {
+		t.Fatalf("unexpected block size: %dx%d, %d", x, y, r.BlockCount())
+	}
+	var pixels []int16
+	for {
+		blk, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blk.Window.YOff != len(pixels)/4 || blk.GeoTransform[3] != 40-0.5*float64(blk.Window.YOff) {
+			t.Fatalf("unexpected block: %+v", blk)
+		}
+		pixels = append(pixels, blk.Data[0]...)
+	}
+	if fmt.Sprint(pixels) != "[-1 1 2 3 4 5 6 7 8 9 10 11]" {
+		t.Fatalf("unexpected block pixels: %v", pixels)
+	}
+}
+
+func TestWriteRaster(t *testing.T) {
+	g := NewGdalToolbox()
+	dir := t.TempDir()
+	gt := [6]float64{110, 0.5, 0, 40, 0, -0.5}
+	mask := filepath.Join(dir, "mask.tif")
+	probs := []float32{-1, 0.25, 0.5, 0.75, 1, 0.125}
+	if err := WriteRaster(g, mask, [][]float32{probs}, 3, 2, gt, OUTPUT_SRID, WithNoData(-1)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadRaster[float32](g, mask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.XSize != 3 || r.YSize != 2 || r.Srid != OUTPUT_SRID || r.GeoTransform != gt || !r.Bands[0].HasNoData || r.Bands[0].NoData != -1 {
+		t.Fatalf("unexpected raster: %+v, %+v", r.RasterInfo, r.Bands)
+	}
+	if fmt.Sprint(r.Data[0]) != fmt.Sprint(probs) {
+		t.Fatalf("unexpected pixels: %v", r.Data[0])
+	}
+	if err = WriteRaster(g, mask, [][]float32{probs[:5]}, 3, 2, gt, OUTPUT_SRID); !errors.Is(err, ErrWrongBufferSize) {
+		t.Fatalf("expect ErrWrongBufferSize, got %v", err)
+	}
+	// COG：内部分块并带金字塔
+	const size = 1024
+	buf := make([]uint8, size*size)
+	for i := range buf {
+		buf[i] = uint8(i % 251)
+	}
+	cog := filepath.Join(dir, "cog.tif")
+	err = WriteRaster(g, cog, [][]uint8{buf}, size, size, gt, OUTPUT_SRID, WithRasterFormat(RasterCOG), WithCreationOptions("RESAMPLING=NEAREST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := gdal.Open(cog, gdal.ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	band := ds.RasterBand(1)
+	if x, y := band.BlockSize(); x != 512 || y != 512 || band.OverviewCount() == 0 {
+		t.Fatalf("unexpected cog layout: block %dx%d, %d overviews", x, y, band.OverviewCount())
+	}
+	if layout := ds.MetadataItem("LAYOUT", "IMAGE_STRUCTURE"); layout != "COG" {
+		t.Fatalf("unexpected layout: %q", layout)
+	}
+	r8, err := ReadRasterWindow[uint8](g, cog, Window{1000, 1000, 2, 1})
+	if err != nil || r8.Data[0][0] != uint8((1000*size+1000)%251) {
+		t.Fatalf("unexpected cog pixels: %v, %v", r8, err)
+	}
+}
+
+func TestPolygonizeRaster(t *testing.T) {
+	g := NewGdalToolbox()
+	dir := t.TempDir()
+	tif := filepath.Join(dir, "class.tif")
+	classes := []uint8{
+		1, 1, 2, 2,
+		1, 1, 2, 0,
+		0, 0, 1, 0,
+	}
+	if err := WriteRaster(g, tif, [][]uint8{classes}, 4, 3, [6]float64{110, 0.5, 0, 40, 0, -0.5}, OUTPUT_SRID); err != nil {
+		t.Fatal(err)
+	}
+	labels := map[int]string{1: "farm", 2: "forest"}
+	summary := func(sps []Speckle) map[string][]float64 {
+		ret := make(map[string][]float64)
+		for _, sp := range sps {
+			geo, err := gdal.CreateFromWKB(sp.Geom, gdal.SpatialReference{}, len(sp.Geom))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ret[sp.ClassName] = append(ret[sp.ClassName], geo.Area())
+			geo.Destroy()
+		}
+		return ret
+	}
+	sps, err := g.PolygonizeRaster(tif, WithLabelTable(labels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := summary(sps); len(sps) != 3 || len(s["farm"]) != 2 || fmt.Sprint(s["forest"]) != "[0.75]" {
+		t.Fatalf("unexpected speckles: %v", s)
+	}
+	// 8连通时对角相邻的像元合并
+	if sps, err = g.PolygonizeRaster(tif, WithLabelTable(labels), WithEightConnected()); err != nil {
+		t.Fatal(err)
+	}
+	if s := summary(sps); fmt.Sprint(s["farm"]) != "[1.25]" {
+		t.Fatalf("unexpected 8-connected speckles: %v", s)
+	}
+	// 单像元斑块并入相邻最大斑块
+	if sps, err = g.PolygonizeRaster(tif, WithLabelTable(labels), WithSieve(2)); err != nil {
+		t.Fatal(err)
+	}
+	if s := summary(sps); fmt.Sprint(s["farm"]) != "[1]" || fmt.Sprint(s["forest"]) != "[1]" {
+		t.Fatalf("unexpected sieved speckles: %v", s)
+	}
+	if sps, err = g.PolygonizeRaster(tif); err != nil {
+		t.Fatal(err)
+	}
+	if s := summary(sps); len(s["0"]) != 2 || sps[0].Attrs[SHP_FIELD_DN] == nil {
+		t.Fatalf("unexpected unlabeled speckles: %v, %v", s, sps[0].Attrs)
+	}
+	shp := filepath.Join(dir, "class.shp")
+	if err = g.PolygonizeRasterToShapefile(tif, shp, "label", WithLabelTable(labels)); err != nil {
+		t.Fatal(err)
+	}
+	if sps, err = g.ParseShapefile(shp, "label"); err != nil || len(sps) != 3 {
+		t.Fatalf("unexpected shapefile: %v, %v", sps, err)
+	}
+	// 影像坐标系无EPSG编码时按其WKT写入
+	custom := filepath.Join(dir, "custom.tif")
+	if err = WriteRaster(g, custom, [][]uint8{classes}, 4, 3, [6]float64{500000, 10, 0, 4000000, 0, -10}, 0); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := gdal.Open(custom, gdal.Update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.SetProjection(testCustomCGCS2000TM)
+	ds.Close()
+	gpkg := filepath.Join(dir, "custom.gpkg")
+	if err = g.PolygonizeRasterToShapefile(custom, gpkg, "label", WithLabelTable(labels)); err != nil {
+		t.Fatal(err)
+	}
+	vds := gdal.OpenDataSource(gpkg, 0)
+	defer vds.Destroy()
+	layer := vds.LayerByIndex(0)
+	wkt, _ := layer.SpatialReference().ToWKT()
+	if n, _ := layer.FeatureCount(true); n != 3 || !strings.Contains(wkt, "CGCS_2000_Custom_TM") {
+		t.Fatalf("unexpected custom crs vector: %d, %s", n, wkt)
+	}
+}
+
+func TestRasterizeSpeckles(t *testing.T) {
+	g := NewGdalToolbox(WithTmpDir(t.TempDir()))
+	dir := t.TempDir()
+	ref := filepath.Join(dir, "class.tif")
+	classes := []uint8{
+		1, 1, 2, 2,
+		1, 1, 2, 0,
+		0, 0, 1, 0,
+	}
+	gt := [6]float64{110, 0.5, 0, 40, 0, -0.5}
+	if err := WriteRaster(g, ref, [][]uint8{classes}, 4, 3, gt, OUTPUT_SRID); err != nil {
+		t.Fatal(err)
+	}
+	sps, err := g.PolygonizeRaster(ref, WithLabelTable(map[int]string{1: "farm", 2: "forest"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 栅格转矢量再转回栅格应与原影像一致
+	out := filepath.Join(dir, "mask.tif")
+	if err = g.RasterizeSpeckles(sps, ref, out, WithClassValues(map[string]float64{"farm": 1, "forest": 2})); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadRaster[uint8](g, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Srid != OUTPUT_SRID || r.GeoTransform != gt || r.Bands[0].DataType != gdal.Byte || fmt.Sprint(r.Data[0]) != fmt.Sprint(classes) {
+		t.Fatalf("unexpected mask: %+v, %v", r.RasterInfo, r.Data[0])
+	}
+	// 重叠的两个图斑：中间两列重叠
+	wkb := func(wkt string) GdalGeo {
+		geo, _ := gdal.CreateFromWKT(wkt, gdal.SpatialReference{})
+		defer geo.Destroy()
+		b, _ := geo.ToWKB()
+		return b
+	}
+	overlap := []Speckle{
+		{Geom: wkb("POLYGON((110 40,111.5 40,111.5 38.5,110 38.5,110 40))"), ClassName: "high"},
+		{Geom: wkb("POLYGON((110.5 40,112 40,112 38.5,110.5 38.5,110.5 40))"), ClassName: "low"},
+	}
+	values := WithClassValues(map[string]float64{"high": 9, "low": 3})
+	grid := RasterInfo{XSize: 4, YSize: 3, GeoTransform: gt, CRS: EPSG(OUTPUT_SRID)}
+	for rule, want := range map[BurnRule]string{
+		BurnLast:  "[9 3 3 3]",
+		BurnFirst: "[9 9 9 3]",
+		BurnMax:   "[9 9 9 3]",
+		BurnMin:   "[9 3 3 3]",
+		BurnAdd:   "[9 12 12 3]",
+	} {
+		if err = g.RasterizeSpecklesToGrid(overlap, grid, out, values, WithBurnRule(rule)); err != nil {
+			t.Fatal(err)
+		}
+		if r, err = ReadRaster[uint8](g, out); err != nil {
+			t.Fatal(err)
+		}
+		if row := fmt.Sprint(r.Data[0][:4]); row != want {
+			t.Fatalf("rule %d: expect %s, got %s", rule, want, row)
+		}
+	}
+	// 只接触像元边角的小图斑：默认不写入，all-touched时写入
+	tiny := []Speckle{{Geom: wkb("POLYGON((110.9 39.1,111.1 39.1,111.1 38.9,110.9 38.9,110.9 39.1))")}}
+	for allTouched, want := range map[bool]int{false: 0, true: 4} {
+		opts := []RasterizeOption{}
+		if allTouched {
+			opts = append(opts, WithAllTouched())
+		}
+		if err = g.RasterizeSpecklesToGrid(tiny, grid, out, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if r, err = ReadRaster[uint8](g, out); err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, v := range r.Data[0] {
+			n += int(v)
+		}
+		if n != want {
+			t.Fatalf("all touched %v: expect %d pixels, got %v", allTouched, want, r.Data[0])
+		}
+	}
+	// 投影坐标系（米）的参考影像：图斑须按网格坐标系写入，不能被当作WGS84重投影
+	projected := filepath.Join(dir, "gk.tif")
+	gkGt := [6]float64{500000, 10, 0, 4000000, 0, -10}
+	if err = WriteRaster(g, projected, [][]uint8{classes}, 4, 3, gkGt, 4548); err != nil {
+		t.Fatal(err)
+	}
+	if sps, err = g.PolygonizeRaster(projected, WithLabelTable(map[int]string{1: "farm", 2: "forest"})); err != nil {
+		t.Fatal(err)
+	}
+	if err = g.RasterizeSpeckles(sps, projected, out, WithClassValues(map[string]float64{"farm": 1, "forest": 2})); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = ReadRaster[uint8](g, out); err != nil {
+		t.Fatal(err)
+	}
+	if r.Srid != 4548 || r.GeoTransform != gkGt || fmt.Sprint(r.Data[0]) != fmt.Sprint(classes) {
+		t.Fatalf("unexpected projected mask: %+v, %v", r.RasterInfo, r.Data[0])
+	}
+	// 无EPSG编码的坐标系同样按原坐标系写入
+	custom := RasterInfo{XSize: 4, YSize: 3, GeoTransform: gkGt, CRS: testCustomCGCS2000TM}
+	if err = g.RasterizeSpecklesToGrid(sps, custom, out, WithClassValues(map[string]float64{"farm": 1, "forest": 2})); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = ReadRaster[uint8](g, out); err != nil {
+		t.Fatal(err)
+	}
+	if r.Srid != 0 || fmt.Sprint(r.Data[0]) != fmt.Sprint(classes) {
+		t.Fatalf("unexpected custom crs mask: %+v, %v", r.RasterInfo, r.Data[0])
+	}
+}
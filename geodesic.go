@@ -0,0 +1,239 @@
+package gdalib
+
+import (
+	"math"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+const (
+	SQ_METERS_PER_MU      = 10000.0 / 15 // 1亩 = 666.67平方米
+	SQ_METERS_PER_HECTARE = 10000.0      // 1公顷 = 10000平方米
+
+	vincentyTol  = 1e-12 // Vincenty迭代的经差收敛阈值（弧度），约0.006毫米
+	vincentyIter = 200
+	ogr25DBit    = 0x80000000
+)
+
+// 参考椭球
+type Ellipsoid struct {
+	A float64 // 长半轴（米）
+	F float64 // 扁率
+}
+
+var (
+	EllipsoidWGS84    = Ellipsoid{6378137, 1 / 298.257223563}
+	EllipsoidCGCS2000 = Ellipsoid{6378137, 1 / 298.257222101}
+)
+
+// 第一偏心率平方
+func (e Ellipsoid) e2() float64 {
+	return e.F * (2 - e.F)
+}
+
+// 等面积纬度换算中的q函数（sinPhi为纬度正弦），等面积球半径为a·sqrt(q(90°)/2)
+func (e Ellipsoid) authalicQ(sinPhi float64) float64 {
+	e2 := e.e2()
+	if e2 == 0 {
+		return 2 * sinPhi
+	}
+	ec := math.Sqrt(e2)
+	es := ec * sinPhi
+	return (1 - e2) * (sinPhi/(1-es*es) - math.Log((1-es)/(1+es))/(2*ec))
+}
+
+// 闭合环（经纬度，度）在椭球面上围成的面积（平方米）
+// 将各点换算为等面积纬度后在等面积球上按大圆边求球面角超，边长远小于地球半径时相对误差约1e-6量级
+func (e Ellipsoid) RingArea(ring [][2]float64) float64 {
+	n := len(ring)
+	if n < 3 {
+		return 0
+	}
+	qp := e.authalicQ(1)
+	halfTanBeta := func(lat float64) float64 {
+		sinBeta := e.authalicQ(math.Sin(lat*degToRad)) / qp
+		return math.Tan(math.Asin(math.Max(-1, math.Min(1, sinBeta))) / 2)
+	}
+	var excess float64
+	t1 := halfTanBeta(ring[n-1][1])
+	for i := 0; i < n; i++ {
+		p1, p2 := ring[(i+n-1)%n], ring[i]
+		t2 := halfTanBeta(p2[1])
+		dLon := math.Remainder((p2[0]-p1[0])*degToRad, 2*math.Pi)
+		excess += 2 * math.Atan2(math.Tan(dLon/2)*(t1+t2), 1+t1*t2)
+		t1 = t2
+	}
+	return math.Abs(excess) * e.A * e.A * qp / 2
+}
+
+// 两点（经纬度，度）间的椭球面测地线距离（米，Vincenty反算，精度约0.5毫米）
+// 近对跖点不收敛时退化为等体积球上的大圆距离
+func (e Ellipsoid) Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	b := e.A * (1 - e.F)
+	L := (lon2 - lon1) * degToRad
+	u1 := math.Atan((1 - e.F) * math.Tan(lat1*degToRad))
+	u2 := math.Atan((1 - e.F) * math.Tan(lat2*degToRad))
+	sinU1, cosU1 := math.Sincos(u1)
+	sinU2, cosU2 := math.Sincos(u2)
+	var (
+		lambda                             = L
+		sinSigma, cosSigma, sigma          float64
+		cosSqAlpha, cos2SigmaM, sinL, cosL float64
+	)
+	converged := false
+	for i := 0; i < vincentyIter; i++ {
+		sinL, cosL = math.Sincos(lambda)
+		sinSigma = math.Hypot(cosU2*sinL, cosU1*sinU2-sinU1*cosU2*cosL)
+		if sinSigma == 0 {
+			return 0 // 重合点
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosL
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinL / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		} else {
+			cos2SigmaM = 0 // 赤道线
+		}
+		c := e.F / 16 * cosSqAlpha * (4 + e.F*(4-3*cosSqAlpha))
+		prev := lambda
+		lambda = L + (1-c)*e.F*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) < vincentyTol {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		r := (2*e.A + b) / 3
+		return r * math.Acos(math.Max(-1, math.Min(1, math.Sin(lat1*degToRad)*math.Sin(lat2*degToRad)+math.Cos(lat1*degToRad)*math.Cos(lat2*degToRad)*math.Cos(L))))
+	}
+	uSq := cosSqAlpha * (e.A*e.A - b*b) / (b * b)
+	bigA := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	bigB := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := bigB * sinSigma * (cos2SigmaM + bigB/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		bigB/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+	return b * bigA * (sigma - deltaSigma)
+}
+
+// 折线（经纬度，度）的椭球面长度（米）
+func (e Ellipsoid) LineLength(line [][2]float64) (length float64) {
+	for i := 1; i < len(line); i++ {
+		length += e.Distance(line[i-1][0], line[i-1][1], line[i][0], line[i][1])
+	}
+	return
+}
+
+// 获取几何的椭球面面积（平方米），geom可为WKB、WKT或GeoJSON（自动识别），srid为其坐标系（投影坐标系时先转为其地理坐标系）
+// 面积按所在坐标系的参考椭球计算，可用SQ_METERS_PER_MU等换算为亩、公顷
+func (g *GdalToolbox) GeodesicArea(geom []byte, srid int) (area float64, err error) {
+	geo, e, err := g.parseGeodesic(geom, srid)
+	if err != nil {
+		return
+	}
+	defer geo.Destroy()
+	area = geoGeodesicArea(geo, e)
+	return
+}
+
+// 获取几何的椭球面长度（米），线为其长度，面为其周长（含内环），参数同GeodesicArea
+func (g *GdalToolbox) GeodesicLength(geom []byte, srid int) (length float64, err error) {
+	geo, e, err := g.parseGeodesic(geom, srid)
+	if err != nil {
+		return
+	}
+	defer geo.Destroy()
+	length = geoGeodesicLength(geo, e)
+	return
+}
+
+// 解析几何并转为地理坐标，同时获取其参考椭球
+func (g *GdalToolbox) parseGeodesic(geom []byte, srid int) (geo gdal.Geometry, e Ellipsoid, err error) {
+	ref, err := g.getSridRef(srid)
+	if err != nil {
+		return
+	}
+	defer ref.Release()
+	if e, err = refEllipsoid(ref); err != nil {
+		g.logger.Error(g.logTag+"get ellipsoid failed", zap.Int("srid", srid), zap.Error(err))
+		return
+	}
+	if geo, _, err = g.parseAnyGeo(geom); err != nil {
+		return
+	}
+	if !ref.IsProjected() {
+		return
+	}
+	geoRef := ref.CloneGeogCS()
+	defer geoRef.Release()
+	geoRef.SetAxisMappingStrategy(gdal.OAMS_TraditionalGisOrder)
+	geo.SetSpatialReference(ref)
+	if err = geo.TransformTo(geoRef); err != nil {
+		g.logger.Error(g.logTag+"geo transform failed", zap.Error(err))
+		geo.Destroy()
+	}
+	return
+}
+
+func refEllipsoid(ref gdal.SpatialReference) (e Ellipsoid, err error) {
+	if e.A, err = ref.SemiMajorAxis(); err != nil {
+		return
+	}
+	invF, err := ref.InverseFlattening()
+	if err != nil {
+		return
+	}
+	if invF != 0 {
+		e.F = 1 / invF
+	}
+	return
+}
+
+// 几何中的点序列（经纬度）
+func geoPoints(geo gdal.Geometry) (pts [][2]float64) {
+	n := geo.PointCount()
+	pts = make([][2]float64, n)
+	for i := 0; i < n; i++ {
+		pts[i][0], pts[i][1], _ = geo.Point(i)
+	}
+	return
+}
+
+func flatType(geo gdal.Geometry) gdal.GeometryType {
+	return geo.Type() &^ ogr25DBit
+}
+
+// 面状几何的椭球面面积（外环减内环），非面状部分面积为0
+func geoGeodesicArea(geo gdal.Geometry, e Ellipsoid) (area float64) {
+	switch flatType(geo) {
+	case gdal.GT_Polygon:
+		for i, n := 0, geo.GeometryCount(); i < n; i++ {
+			a := e.RingArea(geoPoints(geo.Geometry(i)))
+			if i == 0 {
+				area += a
+			} else {
+				area -= a
+			}
+		}
+	case gdal.GT_MultiPolygon, gdal.GT_GeometryCollection:
+		for i, n := 0, geo.GeometryCount(); i < n; i++ {
+			area += geoGeodesicArea(geo.Geometry(i), e)
+		}
+	}
+	return
+}
+
+// 几何的椭球面长度（线长或面周长），点为0
+func geoGeodesicLength(geo gdal.Geometry, e Ellipsoid) (length float64) {
+	switch flatType(geo) {
+	case gdal.GT_LineString, gdal.GT_LinearRing:
+		length = e.LineLength(geoPoints(geo))
+	case gdal.GT_Point, gdal.GT_MultiPoint:
+	default:
+		for i, n := 0, geo.GeometryCount(); i < n; i++ {
+			length += geoGeodesicLength(geo.Geometry(i), e)
+		}
+	}
+	return
+}
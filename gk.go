@@ -0,0 +1,152 @@
+package gdalib
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// CGCS2000高斯克吕格投影的EPSG编码分段
+const (
+	gk6ZoneBase    = 4491     // 6度带，东坐标带带号前缀，13~23带
+	gk6CMBase      = 4502     // 6度带，无带号前缀，中央经线75°~135°
+	gk3ZoneBase    = 4513     // 3度带，东坐标带带号前缀，25~45带
+	gk3CMBase      = 4534     // 3度带，无带号前缀，中央经线75°~135°
+	gkMinCM        = 75       // 最西带的中央经线
+	gkMaxCM        = 135      // 最东带的中央经线
+	gkFalseEasting = 500000.0 // 假东距
+	gk3HalfWidth   = 200000.0 // 3度带内东坐标偏离假东距的上限（约1.5°经差，留有余量）
+	gkZoneUnit     = 1000000.0
+	gkMaxNorthing  = 10000000.0
+)
+
+// .prj（WKT或PROJ字符串）中的中央经线参数
+var prjCMPattern = regexp.MustCompile(`(?i)(?:central_meridian"?\s*,\s*|\+lon_0=)(-?[\d.]+)`)
+
+// 由坐标范围推断CGCS2000高斯克吕格投影的EPSG编码（4491~4554）：
+// 东坐标带带号前缀时按带号区分3度带（25~45）和6度带（13~23）；
+// 不带前缀时需给出中央经线cm（未知时传0），其同为3度带和6度带中央经线时，按东坐标偏离中央经线的距离区分
+func InferCGCS2000GK(b Bounds, cm float64) (srid int, err error) {
+	if b.IsEmpty() || b.MinY <= 0 || b.MaxY >= gkMaxNorthing {
+		err = ErrGKZoneUnknown
+		return
+	}
+	if zone := int(b.MinX / gkZoneUnit); zone > 0 {
+		if int(b.MaxX/gkZoneUnit) != zone {
+			err = ErrGKZoneUnknown
+			return
+		}
+		switch {
+		case zone >= 13 && zone <= 23:
+			srid = gk6ZoneBase + zone - 13
+		case zone >= 25 && zone <= 45:
+			srid = gk3ZoneBase + zone - 25
+		default:
+			err = ErrGKZoneUnknown
+		}
+		return
+	}
+	icm := int(math.Round(cm))
+	if b.MinX <= 0 || math.Abs(cm-float64(icm)) > 1e-6 || icm < gkMinCM || icm > gkMaxCM || icm%3 != 0 {
+		err = ErrGKZoneUnknown
+		return
+	}
+	spread := math.Max(gkFalseEasting-b.MinX, b.MaxX-gkFalseEasting)
+	if (icm-gkMinCM)%6 == 0 && spread > gk3HalfWidth {
+		srid = gk6CMBase + (icm-gkMinCM)/6
+		return
+	}
+	srid = gk3CMBase + (icm-gkMinCM)/3
+	return
+}
+
+// 坐标范围是否在经纬度取值范围内
+func inLonLat(b Bounds) bool {
+	return b.MinX >= -180 && b.MaxX <= 180 && b.MinY >= -90 && b.MaxY <= 90
+}
+
+// 推断矢量文件的CGCS2000高斯克吕格坐标系（见InferCGCS2000GK），中央经线取自WithCentralMeridian或残缺的.prj
+func (g *GdalToolbox) InferShapefileCRS(shp string, opts ...VectorOption) (srid int, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
+		return
+	}
+	defer ds.Destroy()
+	b, err := layerBounds(layer)
+	if err != nil {
+		return
+	}
+	return g.inferLayerGK(shp, layer, b, newVectorConfig(opts).centralMeridian)
+}
+
+func layerBounds(layer gdal.Layer) (b Bounds, err error) {
+	env, err := layer.Extent(true)
+	if err != nil {
+		err = ErrGKZoneUnknown
+		return
+	}
+	b = Bounds{env.MinX(), env.MinY(), env.MaxX(), env.MaxY()}
+	return
+}
+
+func (g *GdalToolbox) inferLayerGK(path string, layer gdal.Layer, b Bounds, cm float64) (srid int, err error) {
+	if cm == 0 {
+		cm = prjCentralMeridian(path, layer.SpatialReference())
+	}
+	if srid, err = InferCGCS2000GK(b, cm); err != nil {
+		g.logger.Error(g.logTag+"infer gk zone failed", zap.String("path", path), zap.Any("bounds", b), zap.Float64("cm", cm))
+		return
+	}
+	g.logger.Info(g.logTag+"inferred gk zone", zap.String("path", path), zap.Int("srid", srid), zap.Float64("cm", cm))
+	return
+}
+
+// 从图层投影坐标系或残缺的.prj文件中提取中央经线，提取不到时为0
+func prjCentralMeridian(path string, sp gdal.SpatialReference) (cm float64) {
+	if sp != (gdal.SpatialReference{}) && sp.IsProjected() {
+		if v, err := sp.ProjectionParameter("central_meridian", 0); err == nil && v != 0 {
+			return v
+		}
+	}
+	buf, err := os.ReadFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".prj")
+	if err != nil {
+		return
+	}
+	if m := prjCMPattern.FindSubmatch(buf); m != nil {
+		cm, _ = strconv.ParseFloat(string(m[1]), 64)
+	}
+	return
+}
+
+// 获取图层坐标系及其srid；无坐标系、或地理坐标系下坐标超出经纬度范围时，尝试按CGCS2000高斯克吕格分带推断，
+// 推断成功时inferred为true，返回的sp需调用方Release；推断失败时保持原结果
+func (g *GdalToolbox) resolveLayerSrs(path string, layer gdal.Layer, cm float64) (sp gdal.SpatialReference, srid int, inferred bool, err error) {
+	sp = layer.SpatialReference()
+	srid, err = g.getLayerSrid(sp)
+	if err != nil && err != ErrVoidSrid {
+		return
+	}
+	if err == nil && !sp.IsGeographic() {
+		return
+	}
+	b, e := layerBounds(layer)
+	if e != nil || (err == nil && inLonLat(b)) {
+		return
+	}
+	g.logger.Info(g.logTag+"layer crs missing or mismatched, try gk zone", zap.String("path", path), zap.Int("srid", srid), zap.Any("bounds", b))
+	gk, e := g.inferLayerGK(path, layer, b, cm)
+	if e != nil {
+		return
+	}
+	if sp, err = g.getSridRef(gk); err != nil {
+		return
+	}
+	srid, inferred = gk, true
+	return
+}
@@ -0,0 +1,195 @@
+package gdalib
+
+import (
+	"math"
+	"sort"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+const strNodeCapacity = 10 // STR树每个节点的最大子节点数
+
+// 矩形范围（外包框）
+type Bounds struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// 空范围，与任何范围都不相交
+var EmptyBounds = Bounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+
+// 获取几何的外包框，空几何返回EmptyBounds
+func geoBounds(geo gdal.Geometry) Bounds {
+	if geo.IsNull() || geo.IsEmpty() {
+		return EmptyBounds
+	}
+	env := geo.Envelope()
+	return Bounds{env.MinX(), env.MinY(), env.MaxX(), env.MaxY()}
+}
+
+// 获取WKB矢量的外包框
+func WkbBounds(wkb GdalGeo) (b Bounds, err error) {
+	if len(wkb) == 0 {
+		return EmptyBounds, nil
+	}
+	geo, err := gdal.CreateFromWKB(wkb, gdal.SpatialReference{}, len(wkb))
+	if err != nil {
+		return
+	}
+	b = geoBounds(geo)
+	geo.Destroy()
+	return
+}
+
+// 是否为空范围
+func (b Bounds) IsEmpty() bool {
+	return b.MinX > b.MaxX || b.MinY > b.MaxY
+}
+
+// 两个范围是否相交（含边界接触）
+func (b Bounds) Intersects(o Bounds) bool {
+	return b.MinX <= o.MaxX && o.MinX <= b.MaxX && b.MinY <= o.MaxY && o.MinY <= b.MaxY
+}
+
+// 两个范围的交集
+func (b Bounds) Intersect(o Bounds) Bounds {
+	r := Bounds{math.Max(b.MinX, o.MinX), math.Max(b.MinY, o.MinY), math.Min(b.MaxX, o.MaxX), math.Min(b.MaxY, o.MaxY)}
+	if r.IsEmpty() {
+		return EmptyBounds
+	}
+	return r
+}
+
+// 同时包含两个范围的最小范围
+func (b Bounds) Expand(o Bounds) Bounds {
+	return Bounds{math.Min(b.MinX, o.MinX), math.Min(b.MinY, o.MinY), math.Max(b.MaxX, o.MaxX), math.Max(b.MaxY, o.MaxY)}
+}
+
+func (b Bounds) center() (x, y float64) {
+	return (b.MinX + b.MaxX) / 2, (b.MinY + b.MaxY) / 2
+}
+
+// 基于外包框的空间索引（STR批量构建的静态R树）
+// 构建后只读，可被多个goroutine并发查询
+type SpatialIndex struct {
+	root *strNode
+	size int
+}
+
+type strNode struct {
+	bounds   Bounds
+	children []*strNode // 为空时是叶子
+	item     int        // 叶子对应的条目序号
+}
+
+// 由各条目的外包框构建空间索引，条目序号即其在bounds中的下标（空范围的条目不入索引）
+func NewSpatialIndex(bounds []Bounds) *SpatialIndex {
+	nodes := make([]*strNode, 0, len(bounds))
+	for i, b := range bounds {
+		if !b.IsEmpty() {
+			nodes = append(nodes, &strNode{bounds: b, item: i})
+		}
+	}
+	s := &SpatialIndex{size: len(nodes)}
+	if len(nodes) == 0 {
+		return s
+	}
+	for len(nodes) > 1 {
+		nodes = strPack(nodes)
+	}
+	s.root = nodes[0]
+	return s
+}
+
+// 由WKB矢量构建空间索引，条目序号即其在gs中的下标
+func (g *GdalToolbox) NewSpatialIndex(gs []GdalGeo) (s *SpatialIndex, err error) {
+	bounds := make([]Bounds, len(gs))
+	for i, wkb := range gs {
+		if bounds[i], err = WkbBounds(wkb); err != nil {
+			g.logger.Error(g.logTag+"parse wkb bounds failed", zap.Int("idx", i), zap.Error(err))
+			return
+		}
+	}
+	s = NewSpatialIndex(bounds)
+	return
+}
+
+// 将一层节点按STR（Sort-Tile-Recursive）打包为上一层节点
+func strPack(nodes []*strNode) (parents []*strNode) {
+	n := len(nodes)
+	leafCnt := (n + strNodeCapacity - 1) / strNodeCapacity
+	sliceCnt := int(math.Ceil(math.Sqrt(float64(leafCnt))))
+	sliceSize := sliceCnt * strNodeCapacity
+	sort.Slice(nodes, func(i, j int) bool {
+		xi, _ := nodes[i].bounds.center()
+		xj, _ := nodes[j].bounds.center()
+		return xi < xj
+	})
+	parents = make([]*strNode, 0, leafCnt)
+	for s := 0; s < n; s += sliceSize {
+		slice := nodes[s:minInt(s+sliceSize, n)]
+		sort.Slice(slice, func(i, j int) bool {
+			_, yi := slice[i].bounds.center()
+			_, yj := slice[j].bounds.center()
+			return yi < yj
+		})
+		for c := 0; c < len(slice); c += strNodeCapacity {
+			children := slice[c:minInt(c+strNodeCapacity, len(slice))]
+			p := &strNode{bounds: EmptyBounds, children: append([]*strNode(nil), children...)}
+			for _, child := range children {
+				p.bounds = p.bounds.Expand(child.bounds)
+			}
+			parents = append(parents, p)
+		}
+	}
+	return
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// 索引中的条目数
+func (s *SpatialIndex) Len() int {
+	return s.size
+}
+
+// 查询外包框与b相交的条目序号（升序）
+func (s *SpatialIndex) Query(b Bounds) (items []int) {
+	if s.root == nil || b.IsEmpty() {
+		return
+	}
+	stack := []*strNode{s.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !node.bounds.Intersects(b) {
+			continue
+		}
+		if node.children == nil {
+			items = append(items, node.item)
+			continue
+		}
+		stack = append(stack, node.children...)
+	}
+	sort.Ints(items)
+	return
+}
+
+// 查询外包框与WKB矢量的外包框相交的条目序号（升序）
+func (s *SpatialIndex) QueryWkb(wkb GdalGeo) (items []int, err error) {
+	b, err := WkbBounds(wkb)
+	if err != nil {
+		return
+	}
+	items = s.Query(b)
+	return
+}
+
+// 查询外包框与几何相交的条目序号（升序）
+func (s *SpatialIndex) queryGeometry(geo gdal.Geometry) []int {
+	return s.Query(geoBounds(geo))
+}
@@ -2,6 +2,8 @@ package log
 
 import (
 	"os"
+	"sync"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -89,7 +91,7 @@ func newLoggerCore(cfg *logConfig) zapcore.Core {
 
 func newLoggerOptions() []zap.Option {
 	caller := zap.AddCaller()
-	callerSkip := zap.AddCallerSkip(1)
+	callerSkip := zap.AddCallerSkip(2) // 包级函数及Logger适配层各占一层
 	development := zap.Development()
 	options := []zap.Option{
 		caller,
@@ -147,32 +149,168 @@ func SetLevel(level string) {
 	aLevel.SetLevel(getZapLevel(level))
 }
 
+// Logger 日志接口，字段沿用zap.Field（见NewZap、NewSlog、Nop等适配器）
+type Logger interface {
+	Debug(msg string, fields ...zap.Field)
+	Info(msg string, fields ...zap.Field)
+	Warn(msg string, fields ...zap.Field)
+	Error(msg string, fields ...zap.Field)
+	// With 返回附带固定字段（如请求ID）的子日志
+	With(fields ...zap.Field) Logger
+}
+
+var (
+	_custom    Logger // SetLogger设定的全局日志，为空时使用内置zap日志
+	_customGen uint64 // 每次SetLogger递增，用于判断withLogger缓存的子日志是否过期
+	_customMu  sync.RWMutex
+)
+
+// SetLogger 替换包级日志（utils等包级函数及未指定日志的GdalToolbox均输出到此），传nil恢复内置zap日志
+func SetLogger(l Logger) {
+	_customMu.Lock()
+	_custom = l
+	_customGen++
+	_customMu.Unlock()
+}
+
+func current() Logger {
+	l, _ := currentGen()
+	return l
+}
+
+func currentGen() (Logger, uint64) {
+	_customMu.RLock()
+	l, gen := _custom, _customGen
+	_customMu.RUnlock()
+	if l == nil {
+		return zapLogger{_logger}, gen
+	}
+	return l, gen
+}
+
+// Default 返回始终转发到当前包级日志的Logger（SetLogger在其后调用也生效）
+func Default() Logger {
+	return defaultLogger{}
+}
+
+type defaultLogger struct{}
+
+func (defaultLogger) Debug(msg string, fields ...zap.Field) { current().Debug(msg, fields...) }
+func (defaultLogger) Info(msg string, fields ...zap.Field)  { current().Info(msg, fields...) }
+func (defaultLogger) Warn(msg string, fields ...zap.Field)  { current().Warn(msg, fields...) }
+func (defaultLogger) Error(msg string, fields ...zap.Field) { current().Error(msg, fields...) }
+func (defaultLogger) With(fields ...zap.Field) Logger       { return newWithLogger(fields) }
+
+// 附带字段且转发到当前包级日志
+// 由当前包级日志派生的子日志被缓存，SetLogger后首次输出时才重新派生，避免每次输出都重新编码字段
+type withLogger struct {
+	fields []zap.Field
+	cache  *atomic.Value // derivedLogger
+}
+
+type derivedLogger struct {
+	gen uint64
+	l   Logger
+}
+
+func newWithLogger(fields []zap.Field) withLogger {
+	return withLogger{fields: fields, cache: &atomic.Value{}}
+}
+
+func (w withLogger) logger() Logger {
+	cur, gen := currentGen()
+	if d, ok := w.cache.Load().(derivedLogger); ok && d.gen == gen {
+		return d.l
+	}
+	l := cur.With(w.fields...)
+	w.cache.Store(derivedLogger{gen, l})
+	return l
+}
+
+func (w withLogger) Debug(msg string, fields ...zap.Field) { w.logger().Debug(msg, fields...) }
+func (w withLogger) Info(msg string, fields ...zap.Field)  { w.logger().Info(msg, fields...) }
+func (w withLogger) Warn(msg string, fields ...zap.Field)  { w.logger().Warn(msg, fields...) }
+func (w withLogger) Error(msg string, fields ...zap.Field) { w.logger().Error(msg, fields...) }
+func (w withLogger) With(fields ...zap.Field) Logger {
+	return newWithLogger(append(w.fields[:len(w.fields):len(w.fields)], fields...))
+}
+
+// NewZap 将zap日志适配为Logger
+func NewZap(l *zap.Logger) Logger {
+	return zapLogger{l.WithOptions(zap.AddCallerSkip(1))}
+}
+
+type zapLogger struct {
+	l *zap.Logger
+}
+
+func (z zapLogger) Debug(msg string, fields ...zap.Field) { z.l.Debug(msg, fields...) }
+func (z zapLogger) Info(msg string, fields ...zap.Field)  { z.l.Info(msg, fields...) }
+func (z zapLogger) Warn(msg string, fields ...zap.Field)  { z.l.Warn(msg, fields...) }
+func (z zapLogger) Error(msg string, fields ...zap.Field) { z.l.Error(msg, fields...) }
+func (z zapLogger) With(fields ...zap.Field) Logger       { return zapLogger{z.l.With(fields...)} }
+func (z zapLogger) Sync() error                           { return z.l.Sync() }
+
+// Nop 丢弃所有日志
+func Nop() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...zap.Field) {}
+func (nopLogger) Info(string, ...zap.Field)  {}
+func (nopLogger) Warn(string, ...zap.Field)  {}
+func (nopLogger) Error(string, ...zap.Field) {}
+func (n nopLogger) With(...zap.Field) Logger { return n }
+
 // Debug output log
 func Debug(msg string, fields ...zap.Field) {
-	_logger.Debug(msg, fields...)
+	current().Debug(msg, fields...)
 }
 
 // Info output log
 func Info(msg string, fields ...zap.Field) {
-	_logger.Info(msg, fields...)
+	current().Info(msg, fields...)
 }
 
 // Warn output log
 func Warn(msg string, fields ...zap.Field) {
-	_logger.Warn(msg, fields...)
+	current().Warn(msg, fields...)
 }
 
 // Error output log
 func Error(msg string, fields ...zap.Field) {
-	_logger.Error(msg, fields...)
+	current().Error(msg, fields...)
 }
 
 // Panic output panic
+// 使用内置zap日志时以panic级别输出（同zap.Logger.Panic），自定义日志无panic级别，以Error输出后panic
 func Panic(msg string, fields ...zap.Field) {
-	_logger.Panic(msg, fields...)
+	if l := current(); isBuiltin(l) {
+		_logger.WithOptions(zap.AddCallerSkip(-1)).Panic(msg, fields...)
+	} else {
+		l.Error(msg, fields...)
+		panic(msg)
+	}
 }
 
 // Fatal output log
+// 使用内置zap日志时以fatal级别输出并同步后退出（同zap.Logger.Fatal），自定义日志以Error输出，实现了Sync时先同步再退出
 func Fatal(msg string, fields ...zap.Field) {
-	_logger.Fatal(msg, fields...)
+	l := current()
+	if isBuiltin(l) {
+		_logger.WithOptions(zap.AddCallerSkip(-1)).Fatal(msg, fields...)
+		return
+	}
+	l.Error(msg, fields...)
+	if s, ok := l.(interface{ Sync() error }); ok {
+		s.Sync()
+	}
+	os.Exit(1)
+}
+
+func isBuiltin(l Logger) bool {
+	z, ok := l.(zapLogger)
+	return ok && z.l == _logger
 }
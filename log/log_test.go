@@ -0,0 +1,25 @@
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPanicKeepsZapLevel(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	old := _logger
+	_logger = zap.New(core)
+	defer func() { _logger = old }()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic")
+		}
+		if all := logs.All(); len(all) != 1 || all[0].Level != zapcore.PanicLevel || all[0].Message != "boom" {
+			t.Fatalf("unexpected entries: %v", all)
+		}
+	}()
+	Panic("boom", zap.String("k", "v"))
+}
@@ -0,0 +1,55 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewSlog 将slog日志适配为Logger，zap字段按其编码结果转为slog属性
+func NewSlog(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) log(level slog.Level, msg string, fields []zap.Field) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.LogAttrs(ctx, level, msg, slogAttrs(fields)...)
+}
+
+func (s slogLogger) Debug(msg string, fields ...zap.Field) { s.log(slog.LevelDebug, msg, fields) }
+func (s slogLogger) Info(msg string, fields ...zap.Field)  { s.log(slog.LevelInfo, msg, fields) }
+func (s slogLogger) Warn(msg string, fields ...zap.Field)  { s.log(slog.LevelWarn, msg, fields) }
+func (s slogLogger) Error(msg string, fields ...zap.Field) { s.log(slog.LevelError, msg, fields) }
+
+func (s slogLogger) With(fields ...zap.Field) Logger {
+	attrs := slogAttrs(fields)
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
+	return slogLogger{s.l.With(args...)}
+}
+
+// 逐个编码zap字段，保持字段顺序
+func slogAttrs(fields []zap.Field) (attrs []slog.Attr) {
+	attrs = make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		for k, v := range enc.Fields {
+			attrs = append(attrs, slog.Any(k, v))
+		}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+//go:build go1.21
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newJSONSlog(buf *bytes.Buffer) Logger {
+	return NewSlog(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) (recs []map[string]interface{}) {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		rec := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	return
+}
+
+func TestSlogWith(t *testing.T) {
+	var buf bytes.Buffer
+	l := newJSONSlog(&buf).With(zap.String("reqId", "r1"))
+	l.Warn("hello", zap.Int("n", 3))
+	recs := decodeLines(t, &buf)
+	if len(recs) != 1 {
+		t.Fatalf("expect 1 record, got %v", buf.String())
+	}
+	r := recs[0]
+	if r["msg"] != "hello" || r["level"] != "WARN" || r["reqId"] != "r1" || r["n"] != float64(3) {
+		t.Fatalf("unexpected record: %v", r)
+	}
+}
+
+func TestDefaultWithFollowsSetLogger(t *testing.T) {
+	defer SetLogger(nil)
+	var first, second bytes.Buffer
+	SetLogger(newJSONSlog(&first))
+	l := Default().With(zap.String("reqId", "r2"))
+	l.Info("a")
+	l.Info("b")
+	// 派生的子日志被缓存，但SetLogger后应转发到新的日志
+	SetLogger(newJSONSlog(&second))
+	l.Info("c")
+	if recs := decodeLines(t, &first); len(recs) != 2 || recs[1]["reqId"] != "r2" {
+		t.Fatalf("unexpected first logger records: %v", recs)
+	}
+	if recs := decodeLines(t, &second); len(recs) != 1 || recs[0]["msg"] != "c" || recs[0]["reqId"] != "r2" {
+		t.Fatalf("unexpected second logger records: %v", recs)
+	}
+}
@@ -0,0 +1,39 @@
+package gdalib
+
+/*
+#include "ogr_api.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/lukeroth/gdal"
+)
+
+// 调用OGR_G_MakeValid修复几何（需GDAL>=3.0且GEOS>=3.8），返回的新几何需调用方Destroy
+// 绑定库未提供该接口，故经由WKB与C层交换几何
+func makeValid(geo gdal.Geometry) (ret gdal.Geometry, err error) {
+	wkb, err := geo.ToWKB()
+	if err != nil {
+		return
+	}
+	var in C.OGRGeometryH
+	if C.OGR_G_CreateFromWkb(unsafe.Pointer(&wkb[0]), nil, &in, C.int(len(wkb))) != C.OGRERR_NONE {
+		err = ErrMakeValid
+		return
+	}
+	defer C.OGR_G_DestroyGeometry(in)
+	out := C.OGR_G_MakeValid(in)
+	if out == nil {
+		err = ErrMakeValid
+		return
+	}
+	defer C.OGR_G_DestroyGeometry(out)
+	buf := make([]byte, int(C.OGR_G_WkbSize(out)))
+	if C.OGR_G_ExportToWkb(out, C.wkbNDR, (*C.uchar)(unsafe.Pointer(&buf[0]))) != C.OGRERR_NONE {
+		err = ErrMakeValid
+		return
+	}
+	return gdal.CreateFromWKB(buf, geo.SpatialReference(), len(buf))
+}
@@ -0,0 +1,181 @@
+package gdalib
+
+import (
+	"math"
+
+	"github.com/wgdzlh/gdalib/utils"
+
+	"github.com/lukeroth/gdal"
+)
+
+// 经纬度坐标系：WGS84（GPS原始坐标，即4326）、GCJ-02（国测局加偏坐标，高德/腾讯地图）、BD-09（百度地图坐标）
+type LonLatSystem int
+
+const (
+	CoordWGS84 LonLatSystem = iota
+	CoordGCJ02
+	CoordBD09
+)
+
+const (
+	gcjA    = 6378245.0             // 克拉索夫斯基椭球长半轴
+	gcjEE   = 0.0066934216229659433 // 克拉索夫斯基椭球第一偏心率平方
+	bdXPi   = math.Pi * 3000 / 180
+	bdDLon  = 0.0065
+	bdDLat  = 0.006
+	invTol  = 1e-10 // 迭代反算的收敛阈值（度）
+	invIter = 30    // 迭代反算的最大次数
+)
+
+func outOfChina(lon, lat float64) bool {
+	return lon < 72.004 || lon > 137.8347 || lat < 0.8293 || lat > 55.8271
+}
+
+func gcjTransformLat(x, y float64) float64 {
+	ret := -100 + 2*x + 3*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(y*math.Pi) + 40*math.Sin(y/3*math.Pi)) * 2 / 3
+	ret += (160*math.Sin(y/12*math.Pi) + 320*math.Sin(y*math.Pi/30)) * 2 / 3
+	return ret
+}
+
+func gcjTransformLon(x, y float64) float64 {
+	ret := 300 + x + 2*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(x*math.Pi) + 40*math.Sin(x/3*math.Pi)) * 2 / 3
+	ret += (150*math.Sin(x/12*math.Pi) + 300*math.Sin(x/30*math.Pi)) * 2 / 3
+	return ret
+}
+
+// WGS84转GCJ-02，中国范围外的坐标不加偏
+func ConvertWgs84ToGcj02(lon, lat float64) (gcjLon, gcjLat float64) {
+	if outOfChina(lon, lat) {
+		return lon, lat
+	}
+	dLat := gcjTransformLat(lon-105, lat-35)
+	dLon := gcjTransformLon(lon-105, lat-35)
+	radLat := lat * degToRad
+	magic := 1 - gcjEE*math.Pow(math.Sin(radLat), 2)
+	sqrtMagic := math.Sqrt(magic)
+	dLat = dLat / ((gcjA * (1 - gcjEE)) / (magic * sqrtMagic) * degToRad)
+	dLon = dLon / (gcjA / sqrtMagic * math.Cos(radLat) * degToRad)
+	return lon + dLon, lat + dLat
+}
+
+// GCJ-02转BD-09
+func ConvertGcj02ToBd09(lon, lat float64) (bdLon, bdLat float64) {
+	z := math.Sqrt(lon*lon+lat*lat) + 0.00002*math.Sin(lat*bdXPi)
+	theta := math.Atan2(lat, lon) + 0.000003*math.Cos(lon*bdXPi)
+	return z*math.Cos(theta) + bdDLon, z*math.Sin(theta) + bdDLat
+}
+
+// 迭代求正算函数fwd的反函数：每次以正算结果与目标之差修正估计值，直至差值小于invTol
+func invertLonLat(fwd func(lon, lat float64) (float64, float64), lon, lat, lon0, lat0 float64) (float64, float64) {
+	x, y := lon0, lat0
+	for i := 0; i < invIter; i++ {
+		fx, fy := fwd(x, y)
+		dx, dy := fx-lon, fy-lat
+		x, y = x-dx, y-dy
+		if math.Abs(dx) < invTol && math.Abs(dy) < invTol {
+			break
+		}
+	}
+	return x, y
+}
+
+// GCJ-02转WGS84（迭代反算，结果再正算与输入之差小于1e-10度，远小于加偏算法本身的精度）
+func ConvertGcj02ToWgs84(lon, lat float64) (wgsLon, wgsLat float64) {
+	if outOfChina(lon, lat) {
+		return lon, lat
+	}
+	return invertLonLat(ConvertWgs84ToGcj02, lon, lat, lon, lat)
+}
+
+// BD-09转GCJ-02（以常用近似公式为初值迭代反算，精度同ConvertGcj02ToWgs84）
+func ConvertBd09ToGcj02(lon, lat float64) (gcjLon, gcjLat float64) {
+	x, y := lon-bdDLon, lat-bdDLat
+	z := math.Sqrt(x*x+y*y) - 0.00002*math.Sin(y*bdXPi)
+	theta := math.Atan2(y, x) - 0.000003*math.Cos(x*bdXPi)
+	return invertLonLat(ConvertGcj02ToBd09, lon, lat, z*math.Cos(theta), z*math.Sin(theta))
+}
+
+// WGS84转BD-09
+func ConvertWgs84ToBd09(lon, lat float64) (bdLon, bdLat float64) {
+	return ConvertGcj02ToBd09(ConvertWgs84ToGcj02(lon, lat))
+}
+
+// BD-09转WGS84
+func ConvertBd09ToWgs84(lon, lat float64) (wgsLon, wgsLat float64) {
+	return ConvertGcj02ToWgs84(ConvertBd09ToGcj02(lon, lat))
+}
+
+// 在任意两种经纬度坐标系之间转换单个点
+func ConvertLonLat(lon, lat float64, from, to LonLatSystem) (float64, float64) {
+	if from == to {
+		return lon, lat
+	}
+	// 以GCJ-02为中转
+	switch from {
+	case CoordWGS84:
+		lon, lat = ConvertWgs84ToGcj02(lon, lat)
+	case CoordBD09:
+		lon, lat = ConvertBd09ToGcj02(lon, lat)
+	}
+	switch to {
+	case CoordWGS84:
+		lon, lat = ConvertGcj02ToWgs84(lon, lat)
+	case CoordBD09:
+		lon, lat = ConvertGcj02ToBd09(lon, lat)
+	}
+	return lon, lat
+}
+
+func (s LonLatSystem) valid() bool {
+	return s >= CoordWGS84 && s <= CoordBD09
+}
+
+// 在任意两种经纬度坐标系之间转换整个几何，geom可为WKB、WKT或GeoJSON（自动识别），输出格式与输入相同
+func (g *GdalToolbox) ConvertGeometry(geom []byte, from, to LonLatSystem) (ret []byte, err error) {
+	if !from.valid() || !to.valid() {
+		err = ErrLonLatSystem
+		return
+	}
+	if from == to {
+		ret = geom
+		return
+	}
+	geo, format, err := g.parseAnyGeo(geom)
+	if err != nil {
+		return
+	}
+	defer geo.Destroy()
+	convertGeoLonLat(geo, from, to)
+	return exportGeo(geo, format)
+}
+
+// 在任意两种经纬度坐标系之间转换WKT
+func (g *GdalToolbox) ConvertWkt(wkt string, from, to LonLatSystem) (ret string, err error) {
+	out, err := g.ConvertGeometry(utils.S2B(wkt), from, to)
+	ret = string(out)
+	return
+}
+
+// 原地转换几何中的所有点
+func convertGeoLonLat(geo gdal.Geometry, from, to LonLatSystem) {
+	if n := geo.GeometryCount(); n > 0 {
+		for i := 0; i < n; i++ {
+			convertGeoLonLat(geo.Geometry(i), from, to)
+		}
+		return
+	}
+	is3D := geo.CoordinateDimension() == 3
+	for i, n := 0, geo.PointCount(); i < n; i++ {
+		x, y, z := geo.Point(i)
+		x, y = ConvertLonLat(x, y, from, to)
+		if is3D {
+			geo.SetPoint(i, x, y, z)
+		} else {
+			geo.SetPoint2D(i, x, y)
+		}
+	}
+}
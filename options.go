@@ -0,0 +1,85 @@
+package gdalib
+
+import "github.com/wgdzlh/gdalib/log"
+
+// 工具箱配置选项（用于NewGdalToolbox）
+type ToolboxOption func(*GdalToolbox)
+
+// 临时文件目录（默认为当前目录）
+func WithTmpDir(dir string) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.tmpDir = dir
+	}
+}
+
+// 影像镶嵌、图斑输出等结果的坐标系（默认OUTPUT_SRID）
+func WithOutputSrid(srid int) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.outputSrid = srid
+	}
+}
+
+// 切割、整形、简化等矢量算法所用的坐标系（默认WKT_ALG_SRID）
+func WithAlgSrid(srid int) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.algSrid = srid
+	}
+}
+
+// ProcessZoneMerge未指定距离时的默认缓冲距离（度，默认MergeBufferDistance）
+func WithMergeBuffer(dis float64) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.mergeBuffer = dis
+	}
+}
+
+// 覆盖率低于该值时输出未覆盖区域（默认CoverageThreshold）
+func WithCoverageThreshold(t float64) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.coverageThreshold = t
+	}
+}
+
+// 简化几何的默认容差（算法坐标系单位，默认SimplifyT）
+func WithSimplifyTolerance(t float64) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.simplifyT = t
+	}
+}
+
+// 判定线与面相交的距离阈值（默认MinIntersectDist）
+func WithMinIntersectDist(dis float64) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.minIntersectDist = dis
+	}
+}
+
+// 切割、整形时切割线的缓冲距离（默认CutLineBuffDist）
+func WithCutBuffer(dis float64) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.cutBuffer = dis
+	}
+}
+
+// 简化后腐蚀、膨胀的缓冲距离占面积平方根的比例（默认BuffPercent）
+func WithBuffPercent(p float64) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.buffPercent = p
+	}
+}
+
+// 是否将GDAL警告与错误输出到日志（见ForwardCPLErrors）
+func WithCPLForward(on bool) ToolboxOption {
+	return func(g *GdalToolbox) {
+		g.cplForward = on
+	}
+}
+
+// 日志输出（默认为包级日志，见log.SetLogger），可用log.NewZap、log.NewSlog、log.Nop适配
+func WithLogger(l log.Logger) ToolboxOption {
+	return func(g *GdalToolbox) {
+		if l != nil {
+			g.logger = l
+		}
+	}
+}
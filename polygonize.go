@@ -0,0 +1,217 @@
+package gdalib
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 栅格转矢量选项
+type PolygonizeOption func(*polygonizeConfig)
+
+type polygonizeConfig struct {
+	band      int            // 波段序号（从1开始）
+	mask      string         // 掩膜影像，为空时使用波段自身的掩膜（无效值像元不参与）
+	labels    map[int]string // 像元值 -> 标签名，非空时只输出表中的像元值
+	connected int            // 4或8连通
+	minPixels int            // 小于该像元数的斑块并入相邻最大斑块
+}
+
+// 指定转换的波段（默认为第1波段）
+func WithPolygonizeBand(band int) PolygonizeOption {
+	return func(cfg *polygonizeConfig) {
+		cfg.band = band
+	}
+}
+
+// 指定掩膜影像（第1波段，像元值为0处不参与转换），须与源影像大小一致
+func WithPolygonizeMask(tif string) PolygonizeOption {
+	return func(cfg *polygonizeConfig) {
+		cfg.mask = tif
+	}
+}
+
+// 指定像元值到标签名（Speckle.ClassName）的对照表，表外的像元值（如背景值）不输出；
+// 未指定时输出全部像元值，标签名为像元值本身
+func WithLabelTable(labels map[int]string) PolygonizeOption {
+	return func(cfg *polygonizeConfig) {
+		cfg.labels = labels
+	}
+}
+
+// 按8连通（含对角相邻）合并像元，默认为4连通
+func WithEightConnected() PolygonizeOption {
+	return func(cfg *polygonizeConfig) {
+		cfg.connected = 8
+	}
+}
+
+// 转换前去除小于minPixels个像元的斑块（并入相邻的最大斑块，同gdal_sieve）
+func WithSieve(minPixels int) PolygonizeOption {
+	return func(cfg *polygonizeConfig) {
+		cfg.minPixels = minPixels
+	}
+}
+
+func newPolygonizeConfig(opts []PolygonizeOption) *polygonizeConfig {
+	cfg := &polygonizeConfig{band: 1, connected: 4}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// 将分类栅格转为图斑（同gdal_polygonize），像元值按整数处理，相同值的连通像元合并为一个面；
+// 图斑几何位于影像坐标系下，Attrs中SHP_FIELD_DN字段为像元值
+func (g *GdalToolbox) PolygonizeRaster(tif string, opts ...PolygonizeOption) (ret []Speckle, err error) {
+	ret, _, err = g.polygonizeRaster(context.Background(), tif, opts)
+	return
+}
+
+// 将分类栅格转为图斑（可通过ctx取消）
+func (g *GdalToolbox) PolygonizeRasterContext(ctx context.Context, tif string, opts ...PolygonizeOption) (ret []Speckle, err error) {
+	ret, _, err = g.polygonizeRaster(ctx, tif, opts)
+	return
+}
+
+// 将分类栅格转为图斑并写入矢量文件（坐标系同影像，格式按扩展名推断），labelField为标签名字段
+func (g *GdalToolbox) PolygonizeRasterToShapefile(tif, shp, labelField string, opts ...PolygonizeOption) (err error) {
+	return g.PolygonizeRasterToShapefileContext(context.Background(), tif, shp, labelField, opts...)
+}
+
+// 将分类栅格转为图斑并写入矢量文件（可通过ctx取消）
+func (g *GdalToolbox) PolygonizeRasterToShapefileContext(ctx context.Context, tif, shp, labelField string, opts ...PolygonizeOption) (err error) {
+	speckles, info, err := g.polygonizeRaster(ctx, tif, opts)
+	if err != nil {
+		return
+	}
+	if info.CRS == "" {
+		g.logger.Error(g.logTag+"tif without crs", zap.String("tif", tif))
+		err = ErrVoidSrid
+		return
+	}
+	// 无EPSG编码时CRS为影像的WKT，按原坐标系写入
+	return g.WriteShapefileCRSContext(ctx, shp, labelField, info.CRS, speckles)
+}
+
+func (g *GdalToolbox) polygonizeRaster(ctx context.Context, tif string, opts []PolygonizeOption) (ret []Speckle, info RasterInfo, err error) {
+	cfg := newPolygonizeConfig(opts)
+	ds, info, _, err := g.openRaster(tif, []int{cfg.band})
+	if err != nil {
+		return
+	}
+	defer ds.Close()
+	src := ds.RasterBand(cfg.band)
+	mask := src.GetMaskBand()
+	if cfg.mask != "" {
+		var mds gdal.Dataset
+		if mds, err = gdal.Open(cfg.mask, gdal.ReadOnly); err != nil {
+			g.logger.Error(g.logTag+"open mask tif failed", zap.String("tif", cfg.mask), zap.Error(err))
+			err = ErrInvalidTif
+			return
+		}
+		defer mds.Close()
+		if mds.RasterXSize() != info.XSize || mds.RasterYSize() != info.YSize {
+			g.logger.Error(g.logTag+"mask size mismatch", zap.String("tif", tif), zap.String("mask", cfg.mask))
+			err = ErrWrongTif
+			return
+		}
+		mask = mds.RasterBand(1)
+	}
+	g.logger.Info(g.logTag+"start polygonize raster", zap.String("tif", tif), zap.Int("band", cfg.band),
+		zap.Int("connected", cfg.connected), zap.Int("minPixels", cfg.minPixels))
+	// 进度回调返回0时GDAL中止，借此响应ctx取消
+	progress := func(float64, string, interface{}) int {
+		if ctx.Err() != nil {
+			return 0
+		}
+		return 1
+	}
+	connOpts := []string{"8CONNECTED=" + strconv.Itoa(cfg.connected)}
+	if cfg.minPixels > 1 {
+		var sds gdal.Dataset
+		if sds, err = g.sieveBand(src, mask, info, cfg, progress); err != nil {
+			return
+		}
+		defer sds.Close()
+		src = sds.RasterBand(1)
+	}
+	// 结果先写入内存图层
+	vds, ok := gdal.OGRDriverByName("Memory").Create("", nil)
+	if !ok {
+		err = ErrGdalDriverCreate
+		return
+	}
+	defer vds.Destroy()
+	layer := vds.CreateLayer("polygons", gdal.SpatialReference{}, gdal.GT_Polygon, nil)
+	fd := gdal.CreateFieldDefinition(SHP_FIELD_DN, gdal.FT_Integer)
+	defer fd.Destroy()
+	if err = layer.CreateField(fd, false); err != nil {
+		return
+	}
+	err = g.withCPL("Polygonize", func() error {
+		return src.Polygonize(mask, layer, 0, connOpts, progress, nil)
+	})
+	if err != nil {
+		if e := ctx.Err(); e != nil {
+			err = e
+			return
+		}
+		g.logger.Error(g.logTag+"polygonize failed", zap.String("tif", tif), zap.Error(err))
+		return
+	}
+	return g.layerSpeckles(ctx, layer, cfg.labels), info, ctx.Err()
+}
+
+// 去除小斑块，结果写入内存影像，返回的ds需调用方Close
+func (g *GdalToolbox) sieveBand(src, mask gdal.RasterBand, info RasterInfo, cfg *polygonizeConfig, progress gdal.ProgressFunc) (ds gdal.Dataset, err error) {
+	driver, err := gdal.GetDriverByName("MEM")
+	if err != nil {
+		err = ErrGdalDriverCreate
+		return
+	}
+	ds = driver.Create("", info.XSize, info.YSize, 1, gdal.Int32, nil)
+	if ds == (gdal.Dataset{}) {
+		err = ErrGdalDriverCreate
+		return
+	}
+	ds.SetGeoTransform(info.GeoTransform)
+	err = g.withCPL("SieveFilter", func() error {
+		return src.SieveFilter(mask, ds.RasterBand(1), cfg.minPixels, cfg.connected, nil, progress, nil)
+	})
+	if err != nil {
+		g.logger.Error(g.logTag+"sieve filter failed", zap.Int("minPixels", cfg.minPixels), zap.Error(err))
+		ds.Close()
+	}
+	return
+}
+
+// 读取转换结果图层中的图斑，labels非空时只保留表中的像元值
+func (g *GdalToolbox) layerSpeckles(ctx context.Context, layer gdal.Layer, labels map[int]string) (ret []Speckle) {
+	n, _ := layer.FeatureCount(false)
+	ret = make([]Speckle, 0, n)
+	layer.ResetReading()
+	for feature := layer.NextFeature(); feature != nil; feature = layer.NextFeature() {
+		if ctx.Err() != nil {
+			feature.Destroy()
+			return nil
+		}
+		v := feature.FieldAsInteger(0)
+		label, ok := labels[v]
+		if labels == nil {
+			label, ok = strconv.Itoa(v), true
+		}
+		if ok {
+			if wkb, e := feature.Geometry().ToWKB(); e != nil {
+				g.logger.Error(g.logTag+"err in wkb convert", zap.Int64("fid", feature.FID()), zap.Error(e))
+			} else {
+				ret = append(ret, Speckle{Geom: wkb, ClassName: label, Attrs: Attributes{SHP_FIELD_DN: int32(v)}})
+			}
+		}
+		feature.Destroy()
+	}
+	g.logger.Info(g.logTag+"polygonize raster done", zap.Int("polygons", n), zap.Int("speckles", len(ret)))
+	return
+}
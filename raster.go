@@ -1,13 +1,13 @@
 package gdalib
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/google/uuid"
 	"github.com/lukeroth/gdal"
-	"github.com/wgdzlh/gdalib/log"
 	"github.com/wgdzlh/gdalib/utils"
 	"go.uber.org/zap"
 )
@@ -17,38 +17,47 @@ const (
 	METEO_TIF_Y = 5211
 )
 
-// 读取一般Tif
+// 读取一般Tif（仅支持Byte类型，其他数据类型见ReadRaster）
 func (g *GdalToolbox) ParseRaster(tif string, bands int) (buf [][]byte, x, y int, err error) {
+	return g.ParseRasterContext(context.Background(), tif, bands)
+}
+
+// 读取一般Tif（可通过ctx在读取各波段之间取消）
+func (g *GdalToolbox) ParseRasterContext(ctx context.Context, tif string, bands int) (buf [][]byte, x, y int, err error) {
 	sds, err := gdal.Open(tif, gdal.ReadOnly)
 	if err != nil {
-		log.Error(g.logTag+"open tif failed", zap.Error(err))
+		g.logger.Error(g.logTag+"open tif failed", zap.Error(err))
 		err = ErrInvalidTif
 		return
 	}
 	defer sds.Close()
 	bc := sds.RasterCount()
 	if bc < bands {
-		log.Error(g.logTag+"tif bands not enough", zap.Int("bands", bc))
+		g.logger.Error(g.logTag+"tif bands not enough", zap.Int("bands", bc))
 		err = ErrWrongTif
 		return
 	}
-	log.Info(g.logTag+"start read tif", zap.Int("bands", bc), zap.Int("bufBn", bands))
+	g.logger.Info(g.logTag+"start read tif", zap.Int("bands", bc), zap.Int("bufBn", bands))
 	buf = make([][]byte, bands)
 	for i := 1; i <= bands; i++ {
+		if err = ctx.Err(); err != nil {
+			buf = nil
+			return
+		}
 		band := sds.RasterBand(i)
 		dt := band.RasterDataType()
 		x = band.XSize()
 		y = band.YSize()
 		if dt != gdal.Byte {
-			log.Error(g.logTag+"tif is malformed", zap.String("dataType", dt.Name()))
+			g.logger.Error(g.logTag+"tif is malformed", zap.String("dataType", dt.Name()))
 			err = ErrWrongTif
 			return
 		}
-		log.Info(g.logTag+"read tif band", zap.Int("band", i), zap.Int("dt", int(dt)), zap.Int("width", x), zap.Int("height", y))
+		g.logger.Info(g.logTag+"read tif band", zap.Int("band", i), zap.Int("dt", int(dt)), zap.Int("width", x), zap.Int("height", y))
 		buf[i-1] = make([]byte, x*y*dt.Size())
 		err = band.IO(gdal.Read, 0, 0, x, y, buf[i-1], x, y, 0, 0)
 		if err != nil {
-			log.Error(g.logTag+"read tif band failed", zap.Int("band", i), zap.Error(err))
+			g.logger.Error(g.logTag+"read tif band failed", zap.Int("band", i), zap.Error(err))
 			err = ErrTifReadFailed
 			return
 		}
@@ -64,13 +73,13 @@ func (g *GdalToolbox) ParseMeteoRaster(tif string, buf []int16) (err error) {
 	}
 	sds, err := gdal.Open(tif, gdal.ReadOnly)
 	if err != nil {
-		log.Error(g.logTag+"open meteo tif failed", zap.Error(err))
+		g.logger.Error(g.logTag+"open meteo tif failed", zap.Error(err))
 		err = ErrInvalidTif
 		return
 	}
 	defer sds.Close()
 	if bc := sds.RasterCount(); bc != 1 {
-		log.Error(g.logTag+"meteo tif can have only one band", zap.Int("bands", bc))
+		g.logger.Error(g.logTag+"meteo tif can have only one band", zap.Int("bands", bc))
 		err = ErrWrongTif
 		return
 	}
@@ -79,14 +88,14 @@ func (g *GdalToolbox) ParseMeteoRaster(tif string, buf []int16) (err error) {
 	x := band.XSize()
 	y := band.YSize()
 	if dt != gdal.Int16 || x != METEO_TIF_X || y != METEO_TIF_Y {
-		log.Error(g.logTag+"meteo tif is malformed", zap.String("dataType", dt.Name()))
+		g.logger.Error(g.logTag+"meteo tif is malformed", zap.String("dataType", dt.Name()))
 		err = ErrWrongTif
 		return
 	}
-	log.Info(g.logTag+"read meteo tif", zap.Int("dt", int(dt)), zap.Int("width", x), zap.Int("height", y))
+	g.logger.Info(g.logTag+"read meteo tif", zap.Int("dt", int(dt)), zap.Int("width", x), zap.Int("height", y))
 	err = band.IO(gdal.Read, 0, 0, x, y, buf, x, y, 0, 0)
 	if err != nil {
-		log.Error(g.logTag+"read meteo tif band failed", zap.Error(err))
+		g.logger.Error(g.logTag+"read meteo tif band failed", zap.Error(err))
 		err = ErrTifReadFailed
 	}
 	return
@@ -96,12 +105,12 @@ func (g *GdalToolbox) ParseMeteoRaster(tif string, buf []int16) (err error) {
 func (g *GdalToolbox) GetMeteoRasterBand(tif string) (band gdal.RasterBand, err error) {
 	sds, err := gdal.Open(tif, gdal.ReadOnly)
 	if err != nil {
-		log.Error(g.logTag+"open meteo tif failed", zap.Error(err))
+		g.logger.Error(g.logTag+"open meteo tif failed", zap.Error(err))
 		err = ErrInvalidTif
 		return
 	}
 	if bc := sds.RasterCount(); bc != 1 {
-		log.Error(g.logTag+"meteo tif can have only one band", zap.Int("bands", bc))
+		g.logger.Error(g.logTag+"meteo tif can have only one band", zap.Int("bands", bc))
 		err = ErrWrongTif
 		return
 	}
@@ -110,11 +119,11 @@ func (g *GdalToolbox) GetMeteoRasterBand(tif string) (band gdal.RasterBand, err
 	x := band.XSize()
 	y := band.YSize()
 	if dt != gdal.Int16 || x != METEO_TIF_X || y != METEO_TIF_Y {
-		log.Error(g.logTag+"meteo tif is malformed", zap.String("dataType", dt.Name()))
+		g.logger.Error(g.logTag+"meteo tif is malformed", zap.String("dataType", dt.Name()))
 		err = ErrWrongTif
 		return
 	}
-	log.Info(g.logTag+"get meteo tif band", zap.Int("dt", int(dt)), zap.Int("width", x), zap.Int("height", y))
+	g.logger.Info(g.logTag+"get meteo tif band", zap.Int("dt", int(dt)), zap.Int("width", x), zap.Int("height", y))
 	return
 }
 
@@ -126,7 +135,7 @@ func (g *GdalToolbox) ReadMeteoRasterBandOffset(band gdal.RasterBand, xOff, yOff
 	buf := make([]int16, 1)
 	err = band.IO(gdal.Read, xOff, yOff, 1, 1, buf, 1, 1, 0, 0)
 	if err != nil {
-		log.Error(g.logTag+"read meteo tif band offset failed", zap.Error(err))
+		g.logger.Error(g.logTag+"read meteo tif band offset failed", zap.Error(err))
 		err = ErrTifReadFailed
 		return
 	}
@@ -141,6 +150,11 @@ func (g *GdalToolbox) CloseMeteoRasterBand(band gdal.RasterBand) {
 // 按各自有效区WKT剪切，并按目标区域WKT镶嵌多张影像tif
 // 排序靠后的tif优先显示
 func (g *GdalToolbox) CropRasters(tifWkt []ImgMergeFile, extWkt, out string) (err error) {
+	return g.CropRastersContext(context.Background(), tifWkt, extWkt, out)
+}
+
+// 按各自有效区WKT剪切，并按目标区域WKT镶嵌多张影像tif（可通过ctx在各剪切、镶嵌步骤之间取消）
+func (g *GdalToolbox) CropRastersContext(ctx context.Context, tifWkt []ImgMergeFile, extWkt, out string) (err error) {
 	n_tif := len(tifWkt)
 	if n_tif == 0 {
 		return
@@ -149,10 +163,12 @@ func (g *GdalToolbox) CropRasters(tifWkt []ImgMergeFile, extWkt, out string) (er
 	if err != nil {
 		return
 	}
-	tRef, err := g.getSridRef(OUTPUT_SRID)
+	defer ref.Release()
+	tRef, err := g.getSridRef(g.outputSrid)
 	if err != nil {
 		return
 	}
+	defer tRef.Release()
 	var (
 		ext        gdal.Geometry
 		geo        gdal.Geometry
@@ -183,7 +199,7 @@ func (g *GdalToolbox) CropRasters(tifWkt []ImgMergeFile, extWkt, out string) (er
 			break
 		}
 	}
-	log.Info(g.logTag+"crop and merge rasters", zap.Int("tif_cnt", n_tif), zap.Bool("uniform", isUniform), zap.String("out", out))
+	g.logger.Info(g.logTag+"crop and merge rasters", zap.Int("tif_cnt", n_tif), zap.Bool("uniform", isUniform), zap.String("out", out))
 	if extWkt != "" {
 		if ext, err = g.parseWKT(extWkt, ref); err != nil {
 			return
@@ -195,6 +211,9 @@ func (g *GdalToolbox) CropRasters(tifWkt []ImgMergeFile, extWkt, out string) (er
 	}
 	hasExt := ext != emptyGeometry && !ext.IsEmpty()
 	for i := n_tif - 1; i >= 0; i-- {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		t := tifWkt[i]
 		if geo, err = g.parseWKB(t.Wkb, ref); err != nil {
 			return
@@ -211,7 +230,7 @@ func (g *GdalToolbox) CropRasters(tifWkt []ImgMergeFile, extWkt, out string) (er
 		}
 		gt := geo.Type()
 		if (gt != gdal.GT_MultiPolygon && gt != gdal.GT_Polygon) || geo.IsEmpty() {
-			log.Info(g.logTag+"encounter empty cut line geo", zap.Int("idx", i), zap.String("img", t.Infile))
+			g.logger.Info(g.logTag+"encounter empty cut line geo", zap.Int("idx", i), zap.String("img", t.Infile))
 			continue
 		}
 		if err = os.WriteFile(tmpGeoJson, utils.S2B(geo.ToJSON()), os.ModePerm); err != nil {
@@ -222,19 +241,23 @@ func (g *GdalToolbox) CropRasters(tifWkt []ImgMergeFile, extWkt, out string) (er
 			return
 		}
 		part = out + fmt.Sprintf("_%d_part.tif", i)
-		opts = []string{"-cutline", tmpGeoJson, "-crop_to_cutline", "-overwrite", "-t_srs", fmt.Sprintf("epsg:%d", OUTPUT_SRID)}
+		opts = []string{"-cutline", tmpGeoJson, "-crop_to_cutline", "-overwrite", "-t_srs", fmt.Sprintf("epsg:%d", g.outputSrid)}
 		if !isUniform && t.BandOrder != "R,G,B" { // 若通道顺序不统一，则全部输出RGB格式影像
 			if bands, invalid := utils.GetBasicBandIdx(t.BandOrder); invalid {
-				log.Error(g.logTag+"invalid band order to merge", zap.String("img", t.Infile), zap.String("bands", t.BandOrder))
+				g.logger.Error(g.logTag+"invalid band order to merge", zap.String("img", t.Infile), zap.String("bands", t.BandOrder))
 				continue
 			} else {
 				opts = append(opts, []string{"-b", bands[0], "-b", bands[1], "-b", bands[2]}...)
 			}
 		}
-		ods, err = gdal.Warp(part, nil, []gdal.Dataset{sds}, opts) // 剪切影像
+		err = g.withCPL("Warp", func() (e error) {
+			ods, e = checkDataset(gdal.Warp(part, nil, []gdal.Dataset{sds}, opts)) // 剪切影像
+			return
+		})
 		sds.Close()
 		if err != nil {
-			log.Error(g.logTag+"failed to crop raster", zap.Error(err))
+			g.logger.Error(g.logTag+"failed to crop raster", zap.Error(err))
+			os.Remove(part)
 			return
 		}
 		defer ods.Close()
@@ -244,21 +267,39 @@ func (g *GdalToolbox) CropRasters(tifWkt []ImgMergeFile, extWkt, out string) (er
 	if len(dss) == 0 {
 		err = ErrEmptyTif
 		return
-	} else if len(dss) > 1 {
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if len(dss) > 1 {
 		defer os.Remove(tmpVrt)
 		// 将各景影像剪切结果拼接成一个VRT
-		if ods, err = gdal.BuildVRT(tmpVrt, dss, parts, []string{"-resolution", "highest", "-overwrite"}); err != nil {
-			log.Error(g.logTag+"failed to build vrt", zap.Error(err))
+		err = g.withCPL("BuildVRT", func() (e error) {
+			ods, e = checkDataset(gdal.BuildVRT(tmpVrt, dss, parts, []string{"-resolution", "highest", "-overwrite"}))
+			return
+		})
+		if err != nil {
+			g.logger.Error(g.logTag+"failed to build vrt", zap.Error(err))
 			return
 		}
 		defer ods.Close()
+		if err = ctx.Err(); err != nil {
+			return
+		}
 	}
 	// 将VRT转为最终GTiff
-	finalDs, err := gdal.Translate(out, ods, []string{"-co", "compress=lzw"})
+	var finalDs gdal.Dataset
+	err = g.withCPL("Translate", func() (e error) {
+		finalDs, e = checkDataset(gdal.Translate(out, ods, []string{"-co", "compress=lzw"}))
+		return
+	})
 	if err != nil {
-		log.Error(g.logTag+"failed to translate vrt", zap.Error(err))
+		g.logger.Error(g.logTag+"failed to translate vrt", zap.Error(err))
 		return
 	}
 	finalDs.Close()
+	if err = ctx.Err(); err != nil {
+		os.Remove(out)
+	}
 	return
 }
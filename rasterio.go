@@ -0,0 +1,263 @@
+package gdalib
+
+import (
+	"context"
+	"math"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 栅格像元对应的Go类型（与GDAL数据类型一一对应：Byte、Int16、UInt16、Int32、UInt32、Float32、Float64）
+type RasterPixel interface {
+	uint8 | int16 | uint16 | int32 | uint32 | float32 | float64
+}
+
+// 栅格影像信息
+type RasterInfo struct {
+	XSize        int
+	YSize        int
+	BandCount    int
+	GeoTransform [6]float64 // 仿射变换参数：地理X = GT[0] + 列*GT[1] + 行*GT[2]，地理Y = GT[3] + 列*GT[4] + 行*GT[5]
+	CRS          CRS        // 坐标系，可识别出等价的EPSG编码时为EPSG形式，否则为WKT，无坐标系时为空
+	Srid         int        // EPSG编码，无法识别或只能按名称推断时为0
+}
+
+// 栅格波段信息
+type BandInfo struct {
+	Index     int           // 波段序号（从1开始）
+	DataType  gdal.DataType // 波段原始数据类型
+	NoData    float64
+	HasNoData bool
+	Scale     float64 // 物理值 = 原始值 * Scale + Offset
+	Offset    float64
+}
+
+// 像元窗口
+type Window struct {
+	XOff  int
+	YOff  int
+	XSize int
+	YSize int
+}
+
+// 读取的栅格数据（XSize、YSize为读取窗口的大小，GeoTransform平移至窗口左上角）
+type Raster[T RasterPixel] struct {
+	RasterInfo
+	Window Window // 在原影像中的像元窗口
+	Bands  []BandInfo
+	Data   [][]T // 与Bands对应的各波段像元，行优先存储
+}
+
+// 按像元类型判断无效值（如Float32波段的无效值-9999.9需按float32精度比较）
+// 无效值按GDAL读取时的规则转为T后再比较，NaN无效值对整数类型不匹配任何像元
+func (r *Raster[T]) noData(band int) func(p T) bool {
+	b := &r.Bands[band]
+	switch {
+	case !b.HasNoData:
+		return func(T) bool { return false }
+	case math.IsNaN(b.NoData):
+		return func(p T) bool { return math.IsNaN(float64(p)) }
+	}
+	nd := pixelValue[T](b.NoData)
+	return func(p T) bool { return p == nd }
+}
+
+// 按GDAL的类型转换规则将非NaN的v转为像元值：整数类型四舍五入，有限值截断至T的取值范围
+func pixelValue[T RasterPixel](v float64) T {
+	lo, hi, isInt := pixelRange[T]()
+	switch {
+	case isInt:
+		v = math.Round(v)
+	case math.IsInf(v, 0):
+		return T(v)
+	}
+	return T(math.Max(lo, math.Min(hi, v)))
+}
+
+// 像元类型的取值范围及是否为整数类型
+func pixelRange[T RasterPixel]() (lo, hi float64, isInt bool) {
+	var p T
+	switch any(p).(type) {
+	case uint8:
+		return 0, math.MaxUint8, true
+	case int16:
+		return math.MinInt16, math.MaxInt16, true
+	case uint16:
+		return 0, math.MaxUint16, true
+	case int32:
+		return math.MinInt32, math.MaxInt32, true
+	case uint32:
+		return 0, math.MaxUint32, true
+	case float32:
+		return -math.MaxFloat32, math.MaxFloat32, false
+	}
+	return -math.MaxFloat64, math.MaxFloat64, false
+}
+
+// 获取第band个读取波段（Bands中的下标）在(x, y)处的物理值，无效值时ok为false
+func (r *Raster[T]) Value(band, x, y int) (v float64, ok bool) {
+	b := &r.Bands[band]
+	p := r.Data[band][y*r.XSize+x]
+	if r.noData(band)(p) {
+		return
+	}
+	return float64(p)*b.Scale + b.Offset, true
+}
+
+// 获取第band个读取波段的全部物理值，无效值为NaN
+func (r *Raster[T]) Values(band int) (vs []float64) {
+	b := &r.Bands[band]
+	isNoData := r.noData(band)
+	vs = make([]float64, len(r.Data[band]))
+	for i, p := range r.Data[band] {
+		if isNoData(p) {
+			vs[i] = math.NaN()
+		} else {
+			vs[i] = float64(p)*b.Scale + b.Offset
+		}
+	}
+	return
+}
+
+// Go类型对应的GDAL数据类型
+func pixelDataType[T RasterPixel]() gdal.DataType {
+	var p T
+	switch any(p).(type) {
+	case uint8:
+		return gdal.Byte
+	case int16:
+		return gdal.Int16
+	case uint16:
+		return gdal.UInt16
+	case int32:
+		return gdal.Int32
+	case uint32:
+		return gdal.UInt32
+	case float32:
+		return gdal.Float32
+	}
+	return gdal.Float64
+}
+
+// 获取栅格影像及其各波段的信息，可据此选择ReadRaster的像元类型
+func (g *GdalToolbox) GetRasterInfo(tif string) (info RasterInfo, bands []BandInfo, err error) {
+	ds, err := gdal.Open(tif, gdal.ReadOnly)
+	if err != nil {
+		g.logger.Error(g.logTag+"open tif failed", zap.String("tif", tif), zap.Error(err))
+		err = ErrInvalidTif
+		return
+	}
+	defer ds.Close()
+	info = g.rasterInfo(ds)
+	bands = make([]BandInfo, info.BandCount)
+	for i := range bands {
+		bands[i] = bandInfo(ds.RasterBand(i + 1))
+	}
+	return
+}
+
+func (g *GdalToolbox) rasterInfo(ds gdal.Dataset) (info RasterInfo) {
+	info = RasterInfo{
+		XSize:        ds.RasterXSize(),
+		YSize:        ds.RasterYSize(),
+		BandCount:    ds.RasterCount(),
+		GeoTransform: ds.GeoTransform(),
+	}
+	wkt := ds.Projection()
+	if wkt == "" {
+		return
+	}
+	info.CRS = CRS(wkt)
+	ref := gdal.CreateSpatialReference(wkt)
+	defer ref.Destroy()
+	if srid := g.exactSrid(ref); srid != 0 {
+		info.Srid, info.CRS = srid, EPSG(srid)
+	}
+	return
+}
+
+func bandInfo(band gdal.RasterBand) (b BandInfo) {
+	b.Index = band.BandNumber()
+	b.DataType = band.RasterDataType()
+	b.NoData, b.HasNoData = band.NoDataValue()
+	var ok bool
+	if b.Scale, ok = band.GetScale(); !ok || b.Scale == 0 {
+		b.Scale = 1
+	}
+	if b.Offset, ok = band.GetOffset(); !ok {
+		b.Offset = 0
+	}
+	return
+}
+
+// 读取栅格影像的指定波段（序号从1开始，未指定时读取全部波段）为像元类型T，
+// 波段原始类型与T不同时由GDAL转换（超出T取值范围的值会被截断），同时返回地理变换参数、坐标系及各波段的无效值、缩放与偏移
+func ReadRaster[T RasterPixel](g *GdalToolbox, tif string, bands ...int) (r *Raster[T], err error) {
+	return ReadRasterContext[T](g, context.Background(), tif, bands...)
+}
+
+// 读取栅格影像的指定波段（可通过ctx在读取各波段之间取消）
+func ReadRasterContext[T RasterPixel](g *GdalToolbox, ctx context.Context, tif string, bands ...int) (r *Raster[T], err error) {
+	ds, info, bands, err := g.openRaster(tif, bands)
+	if err != nil {
+		return
+	}
+	defer ds.Close()
+	return readRasterWindow[T](g, ctx, ds, info, bands, Window{0, 0, info.XSize, info.YSize})
+}
+
+// 校验波段序号，未指定时为全部波段
+func (g *GdalToolbox) checkBands(info RasterInfo, bands []int) ([]int, error) {
+	if len(bands) == 0 {
+		bands = make([]int, info.BandCount)
+		for i := range bands {
+			bands[i] = i + 1
+		}
+	}
+	for _, b := range bands {
+		if b < 1 || b > info.BandCount {
+			g.logger.Error(g.logTag+"tif band not exist", zap.Int("band", b), zap.Int("bands", info.BandCount))
+			return nil, ErrWrongTif
+		}
+	}
+	return bands, nil
+}
+
+// 读取栅格影像中的像元窗口，bands需已校验
+func readRasterWindow[T RasterPixel](g *GdalToolbox, ctx context.Context, ds gdal.Dataset, info RasterInfo, bands []int, w Window) (r *Raster[T], err error) {
+	xOff, yOff, xSize, ySize := w.XOff, w.YOff, w.XSize, w.YSize
+	if xOff < 0 || yOff < 0 || xSize <= 0 || ySize <= 0 || xOff+xSize > info.XSize || yOff+ySize > info.YSize {
+		g.logger.Error(g.logTag+"raster window out of range", zap.Any("window", w), zap.Int("width", info.XSize), zap.Int("height", info.YSize))
+		err = ErrWrongRasterOffset
+		return
+	}
+	gt := info.GeoTransform
+	info.GeoTransform[0] = gt[0] + float64(xOff)*gt[1] + float64(yOff)*gt[2]
+	info.GeoTransform[3] = gt[3] + float64(xOff)*gt[4] + float64(yOff)*gt[5]
+	info.XSize, info.YSize = xSize, ySize
+	r = &Raster[T]{
+		RasterInfo: info,
+		Window:     w,
+		Bands:      make([]BandInfo, len(bands)),
+		Data:       make([][]T, len(bands)),
+	}
+	g.logger.Debug(g.logTag+"start read raster", zap.Ints("bands", bands), zap.String("type", pixelDataType[T]().Name()),
+		zap.Int("xOff", xOff), zap.Int("yOff", yOff), zap.Int("width", xSize), zap.Int("height", ySize))
+	for i, b := range bands {
+		if err = ctx.Err(); err != nil {
+			r = nil
+			return
+		}
+		band := ds.RasterBand(b)
+		r.Bands[i] = bandInfo(band)
+		r.Data[i] = make([]T, xSize*ySize)
+		if err = band.IO(gdal.Read, xOff, yOff, xSize, ySize, r.Data[i], xSize, ySize, 0, 0); err != nil {
+			g.logger.Error(g.logTag+"read tif band failed", zap.Int("band", b), zap.Error(err))
+			err = ErrTifReadFailed
+			r = nil
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,279 @@
+package gdalib
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+const burnField = "burn" // 临时矢量中的写入值字段
+
+// 图斑重叠处的取值规则
+type BurnRule int
+
+const (
+	BurnLast  BurnRule = iota // 按输入顺序，后者覆盖前者（默认）
+	BurnFirst                 // 按输入顺序，前者优先
+	BurnMax                   // 取最大值
+	BurnMin                   // 取最小值
+	BurnAdd                   // 累加
+)
+
+// 矢量转栅格选项
+type RasterizeOption func(*rasterizeConfig)
+
+type rasterizeConfig struct {
+	values     map[string]float64 // 标签名 -> 写入值，为空时全部图斑写入1
+	allTouched bool               // 写入与图斑接触的全部像元，否则只写入中心点落在图斑内的像元
+	rule       BurnRule
+	dataType   gdal.DataType // 为Unknown时按写入值自动选择
+}
+
+// 指定标签名（Speckle.ClassName）到写入值的对照表，表外的图斑不写入；未指定时全部图斑写入1（二值掩膜）
+func WithClassValues(values map[string]float64) RasterizeOption {
+	return func(cfg *rasterizeConfig) {
+		cfg.values = values
+	}
+}
+
+// 写入与图斑接触的全部像元（同gdal_rasterize -at）
+func WithAllTouched() RasterizeOption {
+	return func(cfg *rasterizeConfig) {
+		cfg.allTouched = true
+	}
+}
+
+// 指定图斑重叠处的取值规则（默认BurnLast）
+func WithBurnRule(rule BurnRule) RasterizeOption {
+	return func(cfg *rasterizeConfig) {
+		cfg.rule = rule
+	}
+}
+
+// 指定输出像元类型，默认写入值均为0~255的整数时为Byte，否则为Float32
+func WithBurnDataType(dt gdal.DataType) RasterizeOption {
+	return func(cfg *rasterizeConfig) {
+		cfg.dataType = dt
+	}
+}
+
+func newRasterizeConfig(opts []RasterizeOption) *rasterizeConfig {
+	cfg := &rasterizeConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// 待写入的图斑
+type burnItem struct {
+	idx   int // 在输入中的序号
+	value float64
+}
+
+// 按对照表选取待写入的图斑，并按取值规则排序（GDAL按顺序写入，后写入的覆盖先写入的）
+func (cfg *rasterizeConfig) burnItems(speckles []Speckle) (items []burnItem) {
+	items = make([]burnItem, 0, len(speckles))
+	for i, sp := range speckles {
+		v, ok := 1.0, true
+		if cfg.values != nil {
+			v, ok = cfg.values[sp.ClassName]
+		}
+		if ok {
+			items = append(items, burnItem{i, v})
+		}
+	}
+	switch cfg.rule {
+	case BurnFirst:
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	case BurnMax:
+		sort.SliceStable(items, func(i, j int) bool { return items[i].value < items[j].value })
+	case BurnMin:
+		sort.SliceStable(items, func(i, j int) bool { return items[i].value > items[j].value })
+	}
+	return
+}
+
+// 输出像元类型
+func (cfg *rasterizeConfig) outputType(items []burnItem) gdal.DataType {
+	if cfg.dataType != gdal.Unknown {
+		return cfg.dataType
+	}
+	if cfg.rule == BurnAdd {
+		return gdal.Float32
+	}
+	for _, it := range items {
+		if it.value < 0 || it.value > math.MaxUint8 || it.value != math.Trunc(it.value) {
+			return gdal.Float32
+		}
+	}
+	return gdal.Byte
+}
+
+// 将图斑写入与参考影像相同网格（大小、地理变换参数、坐标系）的GeoTIFF，未被图斑覆盖的像元为0
+// 图斑几何须位于参考影像坐标系下
+func (g *GdalToolbox) RasterizeSpeckles(speckles []Speckle, refTif, out string, opts ...RasterizeOption) (err error) {
+	return g.RasterizeSpecklesContext(context.Background(), speckles, refTif, out, opts...)
+}
+
+// 将图斑写入与参考影像相同网格的GeoTIFF（可通过ctx取消）
+func (g *GdalToolbox) RasterizeSpecklesContext(ctx context.Context, speckles []Speckle, refTif, out string, opts ...RasterizeOption) (err error) {
+	grid, _, err := g.GetRasterInfo(refTif)
+	if err != nil {
+		return
+	}
+	return g.RasterizeSpecklesToGridContext(ctx, speckles, grid, out, opts...)
+}
+
+// 将图斑写入指定网格的GeoTIFF，grid中的XSize、YSize、GeoTransform必填，CRS为空时不写入坐标系（BandCount、Srid不使用）
+func (g *GdalToolbox) RasterizeSpecklesToGrid(speckles []Speckle, grid RasterInfo, out string, opts ...RasterizeOption) (err error) {
+	return g.RasterizeSpecklesToGridContext(context.Background(), speckles, grid, out, opts...)
+}
+
+// 将图斑写入指定网格的GeoTIFF（可通过ctx取消，取消或出错时删除输出文件）
+func (g *GdalToolbox) RasterizeSpecklesToGridContext(ctx context.Context, speckles []Speckle, grid RasterInfo, out string, opts ...RasterizeOption) (err error) {
+	if grid.XSize <= 0 || grid.YSize <= 0 {
+		err = ErrWrongBufferSize
+		return
+	}
+	cfg := newRasterizeConfig(opts)
+	items := cfg.burnItems(speckles)
+	g.logger.Info(g.logTag+"start rasterize speckles", zap.String("out", out), zap.Int("total", len(speckles)), zap.Int("burn", len(items)),
+		zap.Int("width", grid.XSize), zap.Int("height", grid.YSize), zap.Bool("allTouched", cfg.allTouched), zap.Int("rule", int(cfg.rule)))
+	tmpFgb := filepath.Join(g.tmpDir, fmt.Sprintf(TMP_FGB, uuid.NewString()))
+	defer os.Remove(tmpFgb)
+	layerName, err := g.writeBurnVector(ctx, tmpFgb, grid.CRS, speckles, items)
+	if err != nil {
+		return
+	}
+	// 先按网格创建输出影像，gdal_rasterize再以更新方式写入，从而支持任意地理变换参数
+	if err = g.createBurnTarget(out, grid, cfg.outputType(items)); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	vds, err := gdal.OpenEx(tmpFgb, gdal.OFVector|gdal.OFReadOnly, nil, nil, nil)
+	if err != nil {
+		g.logger.Error(g.logTag+"open burn vector failed", zap.Error(err))
+		return
+	}
+	defer vds.Close()
+	args := []string{"-a", burnField, "-l", layerName}
+	if cfg.allTouched {
+		args = append(args, "-at")
+	}
+	if cfg.rule == BurnAdd {
+		args = append(args, "-add")
+	}
+	err = g.withCPL("Rasterize", func() error {
+		ods, e := checkDataset(gdal.Rasterize(out, vds, args))
+		if e == nil {
+			ods.Close()
+		}
+		return e
+	})
+	if err != nil {
+		g.logger.Error(g.logTag+"rasterize failed", zap.String("out", out), zap.Error(err))
+	}
+	return
+}
+
+// 将待写入的图斑按顺序写入临时FlatGeobuf，返回图层名（即文件名主干），无法解析的图斑被跳过
+// 图层带网格坐标系（crs为空时不带），避免GDAL将图斑视为WGS84而重投影到网格坐标系
+func (g *GdalToolbox) writeBurnVector(ctx context.Context, path string, crs CRS, speckles []Speckle, items []burnItem) (layerName string, err error) {
+	var ref gdal.SpatialReference
+	if crs != "" {
+		if ref, err = g.getCRSRef(crs); err != nil {
+			return
+		}
+		defer ref.Release()
+	}
+	ds, ok := gdal.OGRDriverByName(string(FormatFlatGeobuf)).Create(path, nil)
+	if !ok {
+		g.logger.Error(g.logTag+"create burn vector failed", zap.String("path", path))
+		err = ErrGdalDriverCreate
+		return
+	}
+	defer ds.Destroy()
+	layerName = strings.TrimSuffix(filepath.Base(path), FILE_EXT_FGB)
+	// 不建空间索引，否则要素按空间位置重排，打乱取值规则所需的写入顺序
+	layer := ds.CreateLayer(layerName, ref, gdal.GT_Unknown, []string{"SPATIAL_INDEX=NO"})
+	fd := gdal.CreateFieldDefinition(burnField, gdal.FT_Real)
+	defer fd.Destroy()
+	if err = layer.CreateField(fd, false); err != nil {
+		return
+	}
+	def := layer.Definition()
+	for _, it := range items {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		geo, e := g.parseWKB(speckles[it.idx].Geom, ref)
+		if e != nil {
+			g.logger.Error(g.logTag+"skip invalid speckle", zap.Int("idx", it.idx), zap.Error(e))
+			continue
+		}
+		feature := def.Create()
+		feature.SetFieldFloat64(0, it.value)
+		if e = feature.SetGeometryDirectly(geo); e == nil {
+			e = g.withCPL("CreateFeature", func() error { return layer.Create(feature) })
+		}
+		feature.Destroy()
+		if e != nil {
+			g.logger.Error(g.logTag+"skip unwritable speckle", zap.Int("idx", it.idx), zap.Error(e))
+		}
+	}
+	return
+}
+
+// 按网格创建空的输出影像
+func (g *GdalToolbox) createBurnTarget(out string, grid RasterInfo, dt gdal.DataType) (err error) {
+	var wkt string
+	if grid.CRS != "" {
+		var ref gdal.SpatialReference
+		if ref, err = g.getCRSRef(grid.CRS); err != nil {
+			return
+		}
+		wkt, err = ref.ToWKT()
+		ref.Release()
+		if err != nil {
+			return
+		}
+	}
+	driver, err := gdal.GetDriverByName(string(RasterGTiff))
+	if err != nil {
+		err = ErrGdalDriverCreate
+		return
+	}
+	ds := driver.Create(out, grid.XSize, grid.YSize, 1, dt, RasterGTiff.defaultOptions())
+	if ds == (gdal.Dataset{}) {
+		g.logger.Error(g.logTag+"create raster failed", zap.String("out", out))
+		err = ErrGdalDriverCreate
+		return
+	}
+	if err = ds.SetGeoTransform(grid.GeoTransform); err == nil && wkt != "" {
+		err = ds.SetProjection(wkt)
+	}
+	ds.Close()
+	if err != nil {
+		g.logger.Error(g.logTag+"set raster grid failed", zap.Error(err))
+		os.Remove(out)
+	}
+	return
+}
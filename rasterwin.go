@@ -0,0 +1,190 @@
+package gdalib
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 像元坐标（列, 行，可为小数）对应的地理坐标
+func (info RasterInfo) PixelToGeo(px, py float64) (x, y float64) {
+	gt := info.GeoTransform
+	return gt[0] + px*gt[1] + py*gt[2], gt[3] + px*gt[4] + py*gt[5]
+}
+
+// 地理坐标对应的像元坐标（列, 行，小数部分为像元内位置）
+func (info RasterInfo) GeoToPixel(x, y float64) (px, py float64, ok bool) {
+	gt := info.GeoTransform
+	det := gt[1]*gt[5] - gt[2]*gt[4]
+	if det == 0 {
+		return
+	}
+	dx, dy := x-gt[0], y-gt[3]
+	return (gt[5]*dx - gt[2]*dy) / det, (gt[1]*dy - gt[4]*dx) / det, true
+}
+
+// 地理范围（影像坐标系下）覆盖的像元窗口，已裁剪到影像范围内，与影像不相交时ok为false
+func (info RasterInfo) BoundsWindow(b Bounds) (w Window, ok bool) {
+	if b.IsEmpty() {
+		return
+	}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, c := range [][2]float64{{b.MinX, b.MinY}, {b.MinX, b.MaxY}, {b.MaxX, b.MinY}, {b.MaxX, b.MaxY}} {
+		px, py, valid := info.GeoToPixel(c[0], c[1])
+		if !valid {
+			return
+		}
+		minX, maxX = math.Min(minX, px), math.Max(maxX, px)
+		minY, maxY = math.Min(minY, py), math.Max(maxY, py)
+	}
+	x0 := int(math.Max(0, math.Floor(snapPixel(minX))))
+	y0 := int(math.Max(0, math.Floor(snapPixel(minY))))
+	x1 := int(math.Min(float64(info.XSize), math.Ceil(snapPixel(maxX))))
+	y1 := int(math.Min(float64(info.YSize), math.Ceil(snapPixel(maxY))))
+	if x1 <= x0 || y1 <= y0 {
+		return
+	}
+	return Window{x0, y0, x1 - x0, y1 - y0}, true
+}
+
+// 消除浮点误差，避免范围恰好落在像元边界时多取一行（列）
+func snapPixel(p float64) float64 {
+	if r := math.Round(p); math.Abs(p-r) < 1e-6 {
+		return r
+	}
+	return p
+}
+
+// 读取栅格影像中的像元窗口（见ReadRaster）
+func ReadRasterWindow[T RasterPixel](g *GdalToolbox, tif string, w Window, bands ...int) (r *Raster[T], err error) {
+	return ReadRasterWindowContext[T](g, context.Background(), tif, w, bands...)
+}
+
+// 读取栅格影像中的像元窗口（可通过ctx在读取各波段之间取消）
+func ReadRasterWindowContext[T RasterPixel](g *GdalToolbox, ctx context.Context, tif string, w Window, bands ...int) (r *Raster[T], err error) {
+	ds, info, bands, err := g.openRaster(tif, bands)
+	if err != nil {
+		return
+	}
+	defer ds.Close()
+	return readRasterWindow[T](g, ctx, ds, info, bands, w)
+}
+
+// 读取栅格影像中地理范围b（影像坐标系下）覆盖的像元，范围超出影像的部分被裁剪，与影像不相交时返回ErrWrongRasterOffset
+func ReadRasterBounds[T RasterPixel](g *GdalToolbox, tif string, b Bounds, bands ...int) (r *Raster[T], err error) {
+	return ReadRasterBoundsContext[T](g, context.Background(), tif, b, bands...)
+}
+
+// 读取栅格影像中地理范围b覆盖的像元（可通过ctx在读取各波段之间取消）
+func ReadRasterBoundsContext[T RasterPixel](g *GdalToolbox, ctx context.Context, tif string, b Bounds, bands ...int) (r *Raster[T], err error) {
+	ds, info, bands, err := g.openRaster(tif, bands)
+	if err != nil {
+		return
+	}
+	defer ds.Close()
+	w, ok := info.BoundsWindow(b)
+	if !ok {
+		g.logger.Error(g.logTag+"bounds outside raster", zap.String("tif", tif), zap.Any("bounds", b))
+		err = ErrWrongRasterOffset
+		return
+	}
+	return readRasterWindow[T](g, ctx, ds, info, bands, w)
+}
+
+// 打开栅格影像并校验波段，返回的ds需调用方Close
+func (g *GdalToolbox) openRaster(tif string, bands []int) (ds gdal.Dataset, info RasterInfo, checked []int, err error) {
+	if ds, err = gdal.Open(tif, gdal.ReadOnly); err != nil {
+		g.logger.Error(g.logTag+"open tif failed", zap.String("tif", tif), zap.Error(err))
+		err = ErrInvalidTif
+		return
+	}
+	info = g.rasterInfo(ds)
+	if checked, err = g.checkBands(info, bands); err != nil {
+		ds.Close()
+	}
+	return
+}
+
+// 栅格分块流式读取器，按首个读取波段的自然块大小（如GeoTIFF的tile或strip）从左到右、从上到下逐块读取，
+// 内存占用只与块大小有关；非并发安全，用完需调用Close
+type BlockReader[T RasterPixel] struct {
+	ctx    context.Context
+	g      *GdalToolbox
+	ds     gdal.Dataset
+	info   RasterInfo
+	bands  []int
+	blockX int
+	blockY int
+	next   int // 下一块的序号
+	closed bool
+}
+
+// 打开栅格影像并创建分块读取器，bands为波段序号（从1开始，未指定时为全部波段）
+func NewBlockReader[T RasterPixel](g *GdalToolbox, tif string, bands ...int) (r *BlockReader[T], err error) {
+	return NewBlockReaderContext[T](g, context.Background(), tif, bands...)
+}
+
+// 打开栅格影像并创建分块读取器（Next可通过ctx取消）
+func NewBlockReaderContext[T RasterPixel](g *GdalToolbox, ctx context.Context, tif string, bands ...int) (r *BlockReader[T], err error) {
+	ds, info, bands, err := g.openRaster(tif, bands)
+	if err != nil {
+		return
+	}
+	r = &BlockReader[T]{ctx: ctx, g: g, ds: ds, info: info, bands: bands}
+	if r.blockX, r.blockY = ds.RasterBand(bands[0]).BlockSize(); r.blockX <= 0 || r.blockY <= 0 {
+		r.blockX, r.blockY = info.XSize, 1
+	}
+	g.logger.Info(g.logTag+"block reader opened", zap.String("tif", tif), zap.Int("blockX", r.blockX), zap.Int("blockY", r.blockY), zap.Int("blocks", r.BlockCount()))
+	return
+}
+
+// 影像信息
+func (r *BlockReader[T]) Info() RasterInfo {
+	return r.info
+}
+
+// 块大小（边缘块可能更小）
+func (r *BlockReader[T]) BlockSize() (x, y int) {
+	return r.blockX, r.blockY
+}
+
+// 总块数
+func (r *BlockReader[T]) BlockCount() int {
+	return r.blocksPerRow() * ((r.info.YSize + r.blockY - 1) / r.blockY)
+}
+
+func (r *BlockReader[T]) blocksPerRow() int {
+	return (r.info.XSize + r.blockX - 1) / r.blockX
+}
+
+// 读取下一块，Window为其在影像中的位置，读完时返回io.EOF
+func (r *BlockReader[T]) Next() (blk *Raster[T], err error) {
+	if r.closed || r.next >= r.BlockCount() {
+		err = io.EOF
+		return
+	}
+	if err = r.ctx.Err(); err != nil {
+		return
+	}
+	perRow := r.blocksPerRow()
+	w := Window{XOff: r.next % perRow * r.blockX, YOff: r.next / perRow * r.blockY}
+	w.XSize = minInt(r.blockX, r.info.XSize-w.XOff)
+	w.YSize = minInt(r.blockY, r.info.YSize-w.YOff)
+	if blk, err = readRasterWindow[T](r.g, r.ctx, r.ds, r.info, r.bands, w); err != nil {
+		return
+	}
+	r.next++
+	return
+}
+
+// 关闭读取器，释放影像
+func (r *BlockReader[T]) Close() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.ds.Close()
+}
@@ -0,0 +1,211 @@
+package gdalib
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 栅格输出格式（即GDAL驱动名）
+type RasterFormat string
+
+const (
+	RasterGTiff RasterFormat = "GTiff"
+	RasterCOG   RasterFormat = "COG" // 云优化GeoTIFF：内部分块并带金字塔（需GDAL 3.1以上）
+)
+
+// 该格式的默认创建选项（可被WithCreationOptions中的同名选项覆盖）
+func (f RasterFormat) defaultOptions() []string {
+	if f == RasterCOG {
+		// COG驱动默认BLOCKSIZE=512、OVERVIEWS=AUTO，即分块并自动生成金字塔
+		return []string{"COMPRESS=LZW", "BIGTIFF=IF_SAFER"}
+	}
+	return []string{"COMPRESS=LZW", "TILED=YES", "BIGTIFF=IF_SAFER"}
+}
+
+// 栅格写入选项
+type RasterOption func(*rasterConfig)
+
+type rasterConfig struct {
+	format     RasterFormat
+	noData     float64
+	hasNoData  bool
+	createOpts []string
+}
+
+// 指定输出格式（默认为GTiff）
+func WithRasterFormat(format RasterFormat) RasterOption {
+	return func(cfg *rasterConfig) {
+		cfg.format = format
+	}
+}
+
+// 指定各波段的无效值
+func WithNoData(v float64) RasterOption {
+	return func(cfg *rasterConfig) {
+		cfg.noData = v
+		cfg.hasNoData = true
+	}
+}
+
+// 指定GDAL创建选项（KEY=VALUE，如"COMPRESS=DEFLATE"，COG可用"RESAMPLING=NEAREST"指定金字塔重采样方式）
+func WithCreationOptions(opts ...string) RasterOption {
+	return func(cfg *rasterConfig) {
+		cfg.createOpts = append(cfg.createOpts, opts...)
+	}
+}
+
+func newRasterConfig(opts []RasterOption) *rasterConfig {
+	cfg := &rasterConfig{format: RasterGTiff}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// 合并创建选项，默认选项只在未指定同名选项时生效
+func (cfg *rasterConfig) options() (opts []string) {
+	opts = append(opts, cfg.createOpts...)
+	set := make(map[string]bool, len(opts))
+	for _, o := range opts {
+		set[optionKey(o)] = true
+	}
+	for _, o := range cfg.format.defaultOptions() {
+		if !set[optionKey(o)] {
+			opts = append(opts, o)
+		}
+	}
+	return
+}
+
+func optionKey(opt string) string {
+	k, _, _ := strings.Cut(opt, "=")
+	return strings.ToUpper(strings.TrimSpace(k))
+}
+
+// 将各波段像元（行优先存储，长度均为xSize*ySize）写入栅格影像，gt为地理变换参数，srid为坐标系（为0时不写入坐标系）
+func WriteRaster[T RasterPixel](g *GdalToolbox, out string, data [][]T, xSize, ySize int, gt [6]float64, srid int, opts ...RasterOption) (err error) {
+	return WriteRasterContext[T](g, context.Background(), out, data, xSize, ySize, gt, srid, opts...)
+}
+
+// 写入栅格影像（可通过ctx在写入各波段之间取消，取消或出错时删除输出文件）
+// COG需先在内存中生成完整影像再复制为COG，内存占用约为像元数据的两倍
+func WriteRasterContext[T RasterPixel](g *GdalToolbox, ctx context.Context, out string, data [][]T, xSize, ySize int, gt [6]float64, srid int, opts ...RasterOption) (err error) {
+	if xSize <= 0 || ySize <= 0 || len(data) == 0 {
+		err = ErrWrongBufferSize
+		return
+	}
+	for i, buf := range data {
+		if len(buf) != xSize*ySize {
+			g.logger.Error(g.logTag+"wrong band buffer size", zap.Int("band", i+1), zap.Int("len", len(buf)), zap.Int("width", xSize), zap.Int("height", ySize))
+			err = ErrWrongBufferSize
+			return
+		}
+	}
+	var wkt string
+	if srid != 0 {
+		var ref gdal.SpatialReference
+		if ref, err = g.getSridRef(srid); err != nil {
+			return
+		}
+		wkt, err = ref.ToWKT()
+		ref.Release()
+		if err != nil {
+			return
+		}
+	}
+	cfg := newRasterConfig(opts)
+	createOpts := cfg.options()
+	g.logger.Info(g.logTag+"start write raster", zap.String("out", out), zap.String("format", string(cfg.format)),
+		zap.Int("width", xSize), zap.Int("height", ySize), zap.Int("bands", len(data)), zap.Strings("options", createOpts))
+	// COG驱动不支持直接创建，先写入内存数据集
+	path, driverName, dsOpts := out, string(cfg.format), createOpts
+	if cfg.format == RasterCOG {
+		path, driverName, dsOpts = "", "MEM", nil
+	}
+	driver, err := gdal.GetDriverByName(driverName)
+	if err != nil {
+		g.logger.Error(g.logTag+"raster driver not found", zap.String("driver", driverName), zap.Error(err))
+		err = ErrGdalDriverCreate
+		return
+	}
+	var ds gdal.Dataset
+	err = g.withCPL("Create", func() error {
+		if ds = driver.Create(path, xSize, ySize, len(data), pixelDataType[T](), dsOpts); ds == (gdal.Dataset{}) {
+			return ErrGdalDriverCreate
+		}
+		return nil
+	})
+	if err != nil {
+		g.logger.Error(g.logTag+"create raster failed", zap.String("out", out), zap.Error(err))
+		return
+	}
+	defer func() {
+		if err != nil && path != "" {
+			os.Remove(out)
+		}
+	}()
+	if err = fillRaster(g, ctx, ds, data, gt, wkt, cfg); err != nil {
+		ds.Close()
+		return
+	}
+	if cfg.format != RasterCOG {
+		ds.Close()
+		return
+	}
+	defer ds.Close()
+	cog, err := gdal.GetDriverByName(string(RasterCOG))
+	if err != nil {
+		g.logger.Error(g.logTag+"raster driver not found", zap.String("driver", string(RasterCOG)), zap.Error(err))
+		err = ErrGdalDriverCreate
+		return
+	}
+	err = g.withCPL("CreateCopy", func() error {
+		cds := cog.CreateCopy(out, ds, 0, createOpts, nil, nil)
+		if cds == (gdal.Dataset{}) {
+			return ErrGdalDriverCreate
+		}
+		cds.Close()
+		return nil
+	})
+	if err != nil {
+		g.logger.Error(g.logTag+"create cog failed", zap.String("out", out), zap.Error(err))
+		os.Remove(out)
+	}
+	return
+}
+
+// 写入地理变换参数、坐标系及各波段像元
+func fillRaster[T RasterPixel](g *GdalToolbox, ctx context.Context, ds gdal.Dataset, data [][]T, gt [6]float64, wkt string, cfg *rasterConfig) (err error) {
+	if err = ds.SetGeoTransform(gt); err != nil {
+		g.logger.Error(g.logTag+"set geo transform failed", zap.Error(err))
+		return
+	}
+	if wkt != "" {
+		if err = ds.SetProjection(wkt); err != nil {
+			g.logger.Error(g.logTag+"set projection failed", zap.Error(err))
+			return
+		}
+	}
+	xSize, ySize := ds.RasterXSize(), ds.RasterYSize()
+	for i, buf := range data {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		band := ds.RasterBand(i + 1)
+		if cfg.hasNoData {
+			if err = band.SetNoDataValue(cfg.noData); err != nil {
+				g.logger.Error(g.logTag+"set nodata failed", zap.Int("band", i+1), zap.Error(err))
+				return
+			}
+		}
+		if err = band.IO(gdal.Write, 0, 0, xSize, ySize, buf, xSize, ySize, 0, 0); err != nil {
+			g.logger.Error(g.logTag+"write band failed", zap.Int("band", i+1), zap.Error(err))
+			return
+		}
+	}
+	return
+}
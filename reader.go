@@ -0,0 +1,209 @@
+package gdalib
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 矢量要素
+type Feature struct {
+	FID   int64      // 要素ID
+	Geom  GdalGeo    // 要素的矢量WKB（无几何时为nil）
+	Attrs Attributes // 要素属性
+}
+
+// 要素属性：字段名 -> 字段值
+// 字段值类型与OGR字段类型对应：Integer为int32，Integer64为int64，Real为float64，String为string，Date为Date，DateTime为time.Time；
+// 其余类型按string读取，空值为nil
+type Attributes map[string]interface{}
+
+// 日期字段值（对应OGR的Date类型，只保留年月日）
+type Date time.Time
+
+// 矢量要素流式读取器，每次只读取一个要素，读取后立即释放对应的GDAL要素
+// 非并发安全，用完需调用Close
+type FeatureReader struct {
+	ctx    context.Context
+	g      *GdalToolbox
+	path   string
+	ds     gdal.DataSource
+	layer  gdal.Layer
+	fields []gdal.FieldDefinition
+	names  []string
+	repair bool // 读取时修复几何
+	closed bool
+}
+
+// 打开矢量文件并创建要素读取器
+func (g *GdalToolbox) NewFeatureReader(path string, opts ...VectorOption) (r *FeatureReader, err error) {
+	return g.NewFeatureReaderContext(context.Background(), path, opts...)
+}
+
+// 打开矢量文件并创建要素读取器（Next可通过ctx取消）
+func (g *GdalToolbox) NewFeatureReaderContext(ctx context.Context, path string, opts ...VectorOption) (r *FeatureReader, err error) {
+	ds, layer, err := g.openVector(path, false, opts...)
+	if err != nil {
+		return
+	}
+	def := layer.Definition()
+	n := def.FieldCount()
+	r = &FeatureReader{
+		ctx:    ctx,
+		g:      g,
+		path:   path,
+		ds:     ds,
+		layer:  layer,
+		fields: make([]gdal.FieldDefinition, n),
+		names:  make([]string, n),
+		repair: newVectorConfig(opts).repair,
+	}
+	for i := 0; i < n; i++ {
+		r.fields[i] = def.FieldDefinition(i)
+		r.names[i] = r.fields[i].Name()
+	}
+	return
+}
+
+// 字段名列表（按图层中的字段顺序）
+func (r *FeatureReader) Fields() []string {
+	return r.names
+}
+
+// 获取字段序号，不存在时返回-1
+func (r *FeatureReader) FieldIndex(name string) int {
+	return r.layer.Definition().FieldIndex(name)
+}
+
+// 图层要素数（未知时返回-1）
+func (r *FeatureReader) FeatureCount() int {
+	n, ok := r.layer.FeatureCount(false)
+	if !ok {
+		return -1
+	}
+	return n
+}
+
+// 图层的srid
+func (r *FeatureReader) Srid() (srid int, err error) {
+	return r.g.getSrid(r.layer.SpatialReference())
+}
+
+// 读取下一个要素，读完时返回io.EOF
+func (r *FeatureReader) Next() (ft Feature, err error) {
+	feature, err := r.nextFeature()
+	if err != nil {
+		return
+	}
+	defer feature.Destroy()
+	ft.FID = feature.FID()
+	err = r.g.withCPL("ToWKB", func() (e error) {
+		ft.Geom, e = r.featureWKB(feature)
+		return
+	})
+	if err != nil {
+		r.g.logger.Error(r.g.logTag+"err in wkb convert", zap.String("path", r.path), zap.Int64("fid", ft.FID), zap.Error(err))
+		err = newFeatureError(r.path, r.layer, ft.FID, err)
+		return
+	}
+	ft.Attrs = r.readAttrs(feature)
+	return
+}
+
+// 读取下一个GDAL要素，读完时返回io.EOF；返回的feature需调用方立即Destroy
+func (r *FeatureReader) nextFeature() (feature *gdal.Feature, err error) {
+	if r.closed {
+		err = io.EOF
+		return
+	}
+	if err = r.ctx.Err(); err != nil {
+		return
+	}
+	if feature = r.layer.NextFeature(); feature == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// 获取要素几何的WKB（开启修复时先修复），无几何时为nil
+func (r *FeatureReader) featureWKB(feature *gdal.Feature) (wkb GdalGeo, err error) {
+	geo := feature.Geometry()
+	if geo.IsNull() {
+		return
+	}
+	if r.repair {
+		var fixed gdal.Geometry
+		if fixed, err = r.g.repairGeo(geo); err != nil {
+			return
+		}
+		defer fixed.Destroy()
+		geo = fixed
+	}
+	return geo.ToWKB()
+}
+
+func (r *FeatureReader) readAttrs(feature *gdal.Feature) (attrs Attributes) {
+	attrs = make(Attributes, len(r.fields))
+	for i, fd := range r.fields {
+		if !feature.IsFieldSetAndNotNull(i) {
+			attrs[r.names[i]] = nil
+			continue
+		}
+		switch fd.Type() {
+		case gdal.FT_Integer:
+			attrs[r.names[i]] = int32(feature.FieldAsInteger(i))
+		case gdal.FT_Integer64:
+			attrs[r.names[i]] = feature.FieldAsInteger64(i)
+		case gdal.FT_Real:
+			attrs[r.names[i]] = feature.FieldAsFloat64(i)
+		case gdal.FT_Date:
+			if t, ok := feature.FieldAsDateTime(i); ok {
+				attrs[r.names[i]] = Date(t)
+			} else {
+				attrs[r.names[i]] = nil
+			}
+		case gdal.FT_DateTime:
+			if t, ok := feature.FieldAsDateTime(i); ok {
+				attrs[r.names[i]] = t
+			} else {
+				attrs[r.names[i]] = nil
+			}
+		default:
+			attrs[r.names[i]] = feature.FieldAsString(i)
+		}
+	}
+	return
+}
+
+// 关闭读取器并释放数据源
+func (r *FeatureReader) Close() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.ds.Destroy()
+}
+
+// 逐个要素回调处理矢量文件，fn返回错误时中止
+func (g *GdalToolbox) ForEachFeature(ctx context.Context, path string, fn func(Feature) error, opts ...VectorOption) (err error) {
+	r, err := g.NewFeatureReaderContext(ctx, path, opts...)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	var ft Feature
+	for {
+		if ft, err = r.Next(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if err = fn(ft); err != nil {
+			return
+		}
+	}
+}
@@ -1,60 +1,67 @@
 package gdalib
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
-	"github.com/wgdzlh/gdalib/log"
 	"github.com/wgdzlh/gdalib/utils"
 
 	"github.com/lukeroth/gdal"
 	"go.uber.org/zap"
 )
 
-func (g *GdalToolbox) parseShp(shp string, noTrans ...bool) (ret gdal.Geometry, err error) {
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+func (g *GdalToolbox) parseShp(ctx context.Context, shp string, noTrans bool, opts ...VectorOption) (ret gdal.Geometry, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
 	var (
-		layer    = ds.LayerByIndex(0)
-		mayTrans = len(noTrans) == 0 || !noTrans[0]
+		mayTrans = !noTrans
+		inferred bool
 		sp       gdal.SpatialReference
 		srid     int
 		feature  *gdal.Feature
 		gc       []destroyable
 	)
 	if mayTrans {
-		sp = layer.SpatialReference()
-		if srid, err = g.getSrid(sp); err != nil {
+		if sp, srid, inferred, err = g.resolveLayerSrs(shp, layer, newVectorConfig(opts).centralMeridian); err != nil {
 			return
 		}
+		if inferred {
+			defer sp.Release()
+		}
 	}
 	defer func() {
 		for _, v := range gc {
 			v.Destroy()
 		}
 	}()
-	ret = gdal.Create(gdal.GT_Polygon)
+	u := newCascadedUnion()
+	defer u.Destroy()
 	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
-			gc = append(gc, ret)
-			ret = ret.Union(feature.Geometry())
+			u.add(feature.Geometry())
+			feature.Destroy()
 		} else {
 			break
 		}
 	}
+	ret = u.union()
 	if mayTrans && srid != UNIVERSAL_SRID {
 		var tRef gdal.SpatialReference
 		if tRef, err = g.getSridRef(UNIVERSAL_SRID); err == nil {
 			ret.SetSpatialReference(sp)
 			if err = ret.TransformTo(tRef); err != nil {
-				log.Error(g.logTag+"geo transform failed", zap.Error(err))
+				g.logger.Error(g.logTag+"geo transform failed", zap.Error(err))
 			}
+			tRef.Release()
 		}
 		if err != nil {
 			gc = append(gc, ret)
@@ -64,9 +71,14 @@ func (g *GdalToolbox) parseShp(shp string, noTrans ...bool) (ret gdal.Geometry,
 }
 
 // 将shp转为单个WKB（srid=4326）
-func (g *GdalToolbox) GetWkbFromShp(shp string) (ret GdalGeo, err error) {
-	log.Info(g.logTag+"start shp wkb trans", zap.String("shp", shp))
-	geo, err := g.parseShp(shp)
+func (g *GdalToolbox) GetWkbFromShp(shp string, opts ...VectorOption) (ret GdalGeo, err error) {
+	return g.GetWkbFromShpContext(context.Background(), shp, opts...)
+}
+
+// 将shp转为单个WKB（srid=4326，可通过ctx取消）
+func (g *GdalToolbox) GetWkbFromShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret GdalGeo, err error) {
+	g.logger.Info(g.logTag+"start shp wkb trans", zap.String("shp", shp))
+	geo, err := g.parseShp(ctx, shp, false, opts...)
 	if err != nil {
 		return
 	}
@@ -74,14 +86,19 @@ func (g *GdalToolbox) GetWkbFromShp(shp string) (ret GdalGeo, err error) {
 	if !geo.IsEmpty() {
 		ret, err = geo.ToWKB()
 	}
-	log.Info(g.logTag+"got wkb from shp", zap.String("shp", shp), zap.Bool("succeed", err == nil && len(ret) > 0))
+	g.logger.Info(g.logTag+"got wkb from shp", zap.String("shp", shp), zap.Bool("succeed", err == nil && len(ret) > 0))
 	return
 }
 
 // 将shp转为单个WKT（srid=4326）
-func (g *GdalToolbox) GetWktFromShp(shp string) (ret string, err error) {
-	log.Info(g.logTag+"start shp wkt trans", zap.String("shp", shp))
-	geo, err := g.parseShp(shp)
+func (g *GdalToolbox) GetWktFromShp(shp string, opts ...VectorOption) (ret string, err error) {
+	return g.GetWktFromShpContext(context.Background(), shp, opts...)
+}
+
+// 将shp转为单个WKT（srid=4326，可通过ctx取消）
+func (g *GdalToolbox) GetWktFromShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret string, err error) {
+	g.logger.Info(g.logTag+"start shp wkt trans", zap.String("shp", shp))
+	geo, err := g.parseShp(ctx, shp, false, opts...)
 	if err != nil {
 		return
 	}
@@ -89,29 +106,42 @@ func (g *GdalToolbox) GetWktFromShp(shp string) (ret string, err error) {
 	if !geo.IsEmpty() {
 		ret, err = geo.ToWKT()
 	}
-	log.Info(g.logTag+"got wkt from shp", zap.String("shp", shp), zap.Bool("succeed", err == nil && ret != ""))
+	g.logger.Info(g.logTag+"got wkt from shp", zap.String("shp", shp), zap.Bool("succeed", err == nil && ret != ""))
 	return
 }
 
 // 将shp转为GeoJSON（srid=4326）
-func (g *GdalToolbox) GetGeoJSONFromShp(shp string) (ret AnyJson, err error) {
-	log.Info(g.logTag+"start shp GeoJSON trans", zap.String("shp", shp))
-	geo, err := g.parseShp(shp)
+func (g *GdalToolbox) GetGeoJSONFromShp(shp string, opts ...VectorOption) (ret AnyJson, err error) {
+	return g.GetGeoJSONFromShpContext(context.Background(), shp, opts...)
+}
+
+// 将shp转为GeoJSON（srid=4326，可通过ctx取消）
+func (g *GdalToolbox) GetGeoJSONFromShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret AnyJson, err error) {
+	g.logger.Info(g.logTag+"start shp GeoJSON trans", zap.String("shp", shp))
+	geo, err := g.parseShp(ctx, shp, false, opts...)
 	if err != nil {
 		return
 	}
 	defer geo.Destroy()
 	ret = utils.S2B(geo.ToJSON())
-	log.Info(g.logTag+"got GeoJSON from shp", zap.String("shp", shp), zap.Bool("succeed", !geo.IsEmpty()))
+	g.logger.Info(g.logTag+"got GeoJSON from shp", zap.String("shp", shp), zap.Bool("succeed", !geo.IsEmpty()))
 	return
 }
 
 // 从shp文件转化生成geoJson文件，可通过dstSrid指定目标srid
 func (g *GdalToolbox) ShapefileToGeoJSON(shp string, dstSrid ...int) (out string, err error) {
-	log.Info(g.logTag+"start geojson shp", zap.String("shp", shp))
+	return g.ShapefileToGeoJSONContext(context.Background(), shp, dstSrid...)
+}
+
+// 从shp文件转化生成geoJson文件，可通过dstSrid指定目标srid（可通过ctx取消）
+func (g *GdalToolbox) ShapefileToGeoJSONContext(ctx context.Context, shp string, dstSrid ...int) (out string, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	g.logger.Info(g.logTag+"start geojson shp", zap.String("shp", shp))
 	sds, err := gdal.OpenEx(shp, gdal.OFVector, nil, nil, nil)
 	if err != nil {
-		log.Error(g.logTag+"open shp error", zap.Error(err))
+		g.logger.Error(g.logTag+"open shp error", zap.Error(err))
 		return
 	}
 	defer sds.Close()
@@ -122,48 +152,98 @@ func (g *GdalToolbox) ShapefileToGeoJSON(shp string, dstSrid ...int) (out string
 	}
 	prefix := strings.TrimSuffix(shp, FILE_EXT_SHP)
 	out = prefix + fmt.Sprintf("_%d"+FILE_EXT_JSON, tSrid)
-	dds, err := gdal.VectorTranslate(out, []gdal.Dataset{sds}, []string{"-f", "GeoJSON", "-t_srs", fmt.Sprintf("epsg:%d", tSrid)})
+	var dds gdal.Dataset
+	err = g.withCPL("VectorTranslate", func() (e error) {
+		dds, e = checkDataset(gdal.VectorTranslate(out, []gdal.Dataset{sds}, []string{"-f", "GeoJSON", "-t_srs", fmt.Sprintf("epsg:%d", tSrid)}))
+		return
+	})
 	if err != nil {
-		log.Error(g.logTag + "VectorTranslate failed")
+		g.logger.Error(g.logTag+"VectorTranslate failed", zap.Error(err))
 		return
 	}
 	dds.Close() // 生成转换后的json文件
-	log.Info(g.logTag+"end geojson shp", zap.String("shp", shp), zap.String("out", out))
+	if err = ctx.Err(); err != nil {
+		os.Remove(out)
+		return
+	}
+	g.logger.Info(g.logTag+"end geojson shp", zap.String("shp", shp), zap.String("out", out))
 	return
 }
 
 // 转换整个shp文件的坐标系
-func (g *GdalToolbox) TransformShapefile(shp string, tSrid int) (out string, err error) {
-	srid, err := g.GetSridOfShapefile(shp)
-	if err != nil || srid == tSrid {
+func (g *GdalToolbox) TransformShapefile(shp string, tSrid int, opts ...VectorOption) (out string, err error) {
+	return g.TransformShapefileContext(context.Background(), shp, tSrid, opts...)
+}
+
+// 转换整个shp文件的坐标系（可通过ctx取消）
+func (g *GdalToolbox) TransformShapefileContext(ctx context.Context, shp string, tSrid int, opts ...VectorOption) (out string, err error) {
+	return g.TransformShapefileCRSContext(ctx, shp, EPSG(tSrid), opts...)
+}
+
+// 按任意坐标系定义转换整个shp文件的坐标系
+func (g *GdalToolbox) TransformShapefileCRS(shp string, tCRS CRS, opts ...VectorOption) (out string, err error) {
+	return g.TransformShapefileCRSContext(context.Background(), shp, tCRS, opts...)
+}
+
+// 按任意坐标系定义转换整个shp文件的坐标系（可通过ctx取消）
+// .prj缺失时以推断出的高斯克吕格分带作为源坐标系（见InferShapefileCRS）
+func (g *GdalToolbox) TransformShapefileCRSContext(ctx context.Context, shp string, tCRS CRS, opts ...VectorOption) (out string, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	crs, inferred, err := g.shapefileCRS(shp, opts)
+	if err != nil || crs == tCRS {
 		out = shp
 		return
 	}
 	sds, err := gdal.OpenEx(shp, gdal.OFVector, nil, nil, nil)
 	if err != nil {
-		log.Error(g.logTag+"open shp error", zap.Error(err))
+		g.logger.Error(g.logTag+"open shp error", zap.Error(err))
 		return
 	}
 	defer sds.Close()
-	log.Info(g.logTag+"start transform shp", zap.String("shp", shp), zap.Int("srid", tSrid))
-	prefix := strings.TrimSuffix(shp, FILE_EXT_SHP)
-	out = prefix + fmt.Sprintf("_%d"+FILE_EXT_SHP, tSrid)
-	dds, err := gdal.VectorTranslate(out, []gdal.Dataset{sds}, []string{"-t_srs", fmt.Sprintf("epsg:%d", tSrid), "-lco", ENCODING_OPTION})
+	g.logger.Info(g.logTag+"start transform shp", zap.String("shp", shp), zap.String("crs", string(tCRS)))
+	suffix := "_crs"
+	if tSrid, ok := tCRS.epsg(); ok {
+		suffix = fmt.Sprintf("_%d", tSrid)
+	}
+	out = strings.TrimSuffix(shp, FILE_EXT_SHP) + suffix + FILE_EXT_SHP
+	args := []string{"-t_srs", string(tCRS), "-lco", ENCODING_OPTION}
+	if inferred {
+		args = append(args, "-s_srs", string(crs))
+	}
+	var dds gdal.Dataset
+	err = g.withCPL("VectorTranslate", func() (e error) {
+		dds, e = checkDataset(gdal.VectorTranslate(out, []gdal.Dataset{sds}, args))
+		return
+	})
 	if err != nil {
-		log.Error(g.logTag + "VectorTranslate failed")
+		g.logger.Error(g.logTag+"VectorTranslate failed", zap.Error(err))
 		return
 	}
 	dds.Close() // 生成转换后的shp文件
+	if err = ctx.Err(); err != nil {
+		deleteVector(out, FormatShapefile)
+		return
+	}
 
 	if e := sds.Driver().DeleteDataset(shp); e != nil {
-		log.Info(g.logTag+"delete old shp failed", zap.Error(e))
+		g.logger.Info(g.logTag+"delete old shp failed", zap.Error(e))
 	}
-	log.Info(g.logTag+"end transform shp", zap.String("shp", out))
+	g.logger.Info(g.logTag+"end transform shp", zap.String("shp", out))
 	return
 }
 
 // 转换整个shp文件的文本编码
 func (g *GdalToolbox) EncodingShapefile(shp, cpg string, rmOld bool) (out string, err error) {
+	return g.EncodingShapefileContext(context.Background(), shp, cpg, rmOld)
+}
+
+// 转换整个shp文件的文本编码（可通过ctx取消）
+func (g *GdalToolbox) EncodingShapefileContext(ctx context.Context, shp, cpg string, rmOld bool) (out string, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	if cpg == SHAPE_ENCODING || cpg == UTF8_ENC {
 		out = shp
 		return
@@ -171,66 +251,75 @@ func (g *GdalToolbox) EncodingShapefile(shp, cpg string, rmOld bool) (out string
 	// cpg为空，或者不为UTF-8的，都当作GBK编码处理
 	sds, err := gdal.OpenEx(shp, gdal.OFVector, nil, []string{OO_ENCODING}, nil)
 	if err != nil {
-		log.Error(g.logTag+"open shp error", zap.Error(err))
+		g.logger.Error(g.logTag+"open shp error", zap.Error(err))
 		return
 	}
 	defer sds.Close()
-	log.Info(g.logTag+"start encoding shp", zap.String("shp", shp), zap.String("cpg", cpg))
+	g.logger.Info(g.logTag+"start encoding shp", zap.String("shp", shp), zap.String("cpg", cpg))
 	prefix := strings.TrimSuffix(shp, FILE_EXT_SHP)
 	out = prefix + fmt.Sprintf("_%s"+FILE_EXT_SHP, cpg)
-	dds, err := gdal.VectorTranslate(out, []gdal.Dataset{sds}, []string{"-lco", ENCODING_OPTION})
+	var dds gdal.Dataset
+	err = g.withCPL("VectorTranslate", func() (e error) {
+		dds, e = checkDataset(gdal.VectorTranslate(out, []gdal.Dataset{sds}, []string{"-lco", ENCODING_OPTION}))
+		return
+	})
 	if err != nil {
-		log.Error(g.logTag + "VectorTranslate failed")
+		g.logger.Error(g.logTag+"VectorTranslate failed", zap.Error(err))
 		return
 	}
 	dds.Close() // 生成转换后的shp文件
+	if err = ctx.Err(); err != nil {
+		deleteVector(out, FormatShapefile)
+		return
+	}
 
 	// cmd := exec.Command("ogr2ogr", out, shp, "-oo", OO_ENCODING, "-lco", ENCODING_OPTION)
 	// err = cmd.Run()
 
 	if rmOld {
 		if e := sds.Driver().DeleteDataset(shp); e != nil {
-			log.Info(g.logTag+"delete old shp failed", zap.Error(e))
+			g.logger.Info(g.logTag+"delete old shp failed", zap.Error(e))
 		}
 	}
-	log.Info(g.logTag+"end encoding shp", zap.String("shp", out))
-	// log.Info(g.logTag+"end encoding shp", zap.String("cmd", cmd.String()), zap.String("shp", out))
+	g.logger.Info(g.logTag+"end encoding shp", zap.String("shp", out))
+	// g.logger.Info(g.logTag+"end encoding shp", zap.String("cmd", cmd.String()), zap.String("shp", out))
 	return
 }
 
 // 获取shp文件中的标签
-func (g *GdalToolbox) GetLabelsFromShapefile(shp, labelField string) (labels []string, err error) {
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+func (g *GdalToolbox) GetLabelsFromShapefile(shp, labelField string, opts ...VectorOption) (labels []string, err error) {
+	return g.GetLabelsFromShapefileContext(context.Background(), shp, labelField, opts...)
+}
+
+// 获取shp文件中的标签（可通过ctx取消）
+func (g *GdalToolbox) GetLabelsFromShapefileContext(ctx context.Context, shp, labelField string, opts ...VectorOption) (labels []string, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	layer := ds.LayerByIndex(0)
 	labelIdx := layer.Definition().FieldIndex(labelField)
 	if labelIdx < 0 {
-		err = fmt.Errorf(ErrColumnMissingTemplate, labelField)
+		err = newFieldError(shp, layer, labelField, -1, ErrColumnMissing)
 		return
 	}
 	var (
 		labelSet = map[string]struct{}{}
 		feature  *gdal.Feature
 		label    string
+		fid      int64
 		cnt      int
-		gc       []destroyable
 	)
-	defer func() {
-		for _, v := range gc {
-			v.Destroy()
-		}
-	}()
 	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
-			label = feature.FieldAsString(labelIdx)
+			// 逐个释放要素，避免大文件解析时内存随要素数线性增长
+			label, fid = feature.FieldAsString(labelIdx), feature.FID()
+			feature.Destroy()
 			if label == "" {
-				err = fmt.Errorf(ErrColumnEmptyTemplate, labelField)
+				err = newFieldError(shp, layer, labelField, fid, ErrColumnEmpty)
 				return
 			}
 			labelSet[label] = struct{}{}
@@ -242,97 +331,100 @@ func (g *GdalToolbox) GetLabelsFromShapefile(shp, labelField string) (labels []s
 	for k := range labelSet {
 		labels = append(labels, k)
 	}
-	log.Info(g.logTag+"got labels from shp", zap.String("file", shp), zap.Any("labels", labels), zap.Int("cnt", cnt))
+	g.logger.Info(g.logTag+"got labels from shp", zap.String("file", shp), zap.Any("labels", labels), zap.Int("cnt", cnt))
 	return
 }
 
 // 从shp文件中解析出图斑矢量
-func (g *GdalToolbox) ParseShapefile(shp, labelField string) (ret []Speckle, err error) {
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+func (g *GdalToolbox) ParseShapefile(shp, labelField string, opts ...VectorOption) (ret []Speckle, err error) {
+	return g.ParseShapefileContext(context.Background(), shp, labelField, opts...)
+}
+
+// 从shp文件中解析出图斑矢量（可通过ctx取消，可通过WithRepair在读取时修复几何）
+func (g *GdalToolbox) ParseShapefileContext(ctx context.Context, shp, labelField string, opts ...VectorOption) (ret []Speckle, err error) {
+	r, err := g.NewFeatureReaderContext(ctx, shp, opts...)
+	if err != nil {
 		return
 	}
-	defer ds.Destroy()
-	layer := ds.LayerByIndex(0)
-	def := layer.Definition()
+	defer r.Close()
 	labelIdx := -1
 	if labelField != "" {
-		labelIdx = def.FieldIndex(labelField)
+		labelIdx = r.FieldIndex(labelField)
 		if labelIdx < 0 {
-			err = fmt.Errorf(ErrColumnMissingTemplate, labelField)
+			err = newFieldError(shp, r.layer, labelField, -1, ErrColumnMissing)
 			return
 		}
 	}
-	ret = make([]Speckle, 0, 128)
+	n := 128
+	if nf := r.FeatureCount(); nf > 0 {
+		n = nf
+	}
+	ret = make([]Speckle, 0, n)
 	var (
 		feature *gdal.Feature
-		geo     gdal.Geometry
 		wkb     []byte
 		e       error
-		gc      []destroyable
 	)
-	defer func() {
-		for _, v := range gc {
-			v.Destroy()
-		}
-	}()
 	for {
-		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
-			geo = feature.Geometry()
-			wkb, e = geo.ToWKB()
-			if e != nil {
-				log.Error(g.logTag+"err in wkb convert", zap.String("geom", geo.ToGML()), zap.Error(e))
-				continue
-			}
-			sp := Speckle{
-				Geom: wkb,
-			}
-			if labelIdx >= 0 {
-				sp.ClassName = feature.FieldAsString(labelIdx)
+		if feature, err = r.nextFeature(); err != nil {
+			if err == io.EOF {
+				err = nil
+			} else {
+				ret = nil
 			}
-			ret = append(ret, sp)
-		} else {
 			return
 		}
+		// 逐个释放要素，避免大文件解析时内存随要素数线性增长
+		if wkb, e = r.featureWKB(feature); e != nil || wkb == nil {
+			g.logger.Error(g.logTag+"err in wkb convert", zap.Int64("fid", feature.FID()), zap.Error(e))
+			feature.Destroy()
+			continue
+		}
+		sp := Speckle{
+			Geom: wkb,
+		}
+		if labelIdx >= 0 {
+			sp.ClassName = feature.FieldAsString(labelIdx)
+		}
+		sp.Attrs = r.readAttrs(feature)
+		feature.Destroy()
+		ret = append(ret, sp)
 	}
 }
 
 // 从shp文件中解析出图斑矢量Wkt
-func (g *GdalToolbox) ParseShapefileToWkt(shp string) (ret []string, err error) {
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+func (g *GdalToolbox) ParseShapefileToWkt(shp string, opts ...VectorOption) (ret []string, err error) {
+	return g.ParseShapefileToWktContext(context.Background(), shp, opts...)
+}
+
+// 从shp文件中解析出图斑矢量Wkt（可通过ctx取消）
+func (g *GdalToolbox) ParseShapefileToWktContext(ctx context.Context, shp string, opts ...VectorOption) (ret []string, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	layer := ds.LayerByIndex(0)
 	ret = make([]string, 0, 128)
 	var (
 		feature *gdal.Feature
 		geo     gdal.Geometry
 		wkt     string
 		e       error
-		gc      []destroyable
 	)
-	defer func() {
-		for _, v := range gc {
-			v.Destroy()
-		}
-	}()
 	for {
+		if err = ctx.Err(); err != nil {
+			ret = nil
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
 			geo = feature.Geometry()
 			wkt, e = geo.ToWKT()
 			if e != nil {
-				log.Error(g.logTag+"err in wkt convert", zap.String("geom", geo.ToGML()), zap.Error(e))
-				continue
+				g.logger.Error(g.logTag+"err in wkt convert", zap.String("geom", geo.ToGML()), zap.Error(e))
+			} else {
+				ret = append(ret, wkt)
 			}
-			ret = append(ret, wkt)
+			feature.Destroy() // 逐个释放要素
 		} else {
 			return
 		}
@@ -340,7 +432,12 @@ func (g *GdalToolbox) ParseShapefileToWkt(shp string) (ret []string, err error)
 }
 
 // 更新shp文件中的标签，可通过zone shp（两个shp坐标系要一致）指定更新/截取区域
-func (g *GdalToolbox) UpdateLabelInShapefile(shp, labelField, zone string, alignRet AlignedLabel) (err error) {
+func (g *GdalToolbox) UpdateLabelInShapefile(shp, labelField, zone string, alignRet AlignedLabel, opts ...VectorOption) (err error) {
+	return g.UpdateLabelInShapefileContext(context.Background(), shp, labelField, zone, alignRet, opts...)
+}
+
+// 更新shp文件中的标签（可通过ctx取消，已更新的要素不回滚）
+func (g *GdalToolbox) UpdateLabelInShapefileContext(ctx context.Context, shp, labelField, zone string, alignRet AlignedLabel, opts ...VectorOption) (err error) {
 	needUpdate := false
 	for key, pair := range alignRet {
 		if key != pair[0] {
@@ -351,92 +448,71 @@ func (g *GdalToolbox) UpdateLabelInShapefile(shp, labelField, zone string, align
 	if !needUpdate && zone == "" {
 		return
 	}
-	log.Info(g.logTag+"update label with ref", zap.Any("alignRet", alignRet), zap.String("zoneShp", zone))
+	g.logger.Info(g.logTag+"update label with ref", zap.Any("alignRet", alignRet), zap.String("zoneShp", zone))
 	mz := emptyGeometry
 	if zone != "" {
-		if mz, err = g.parseShp(zone, true); err != nil {
+		if mz, err = g.parseShp(ctx, zone, true); err != nil {
 			return
 		}
+		defer mz.Destroy()
 	}
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 1)
-	if !ok {
-		err = ErrGdalDriverOpen
+	ds, layer, err := g.openVector(shp, true, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	layer := ds.LayerByIndex(0)
 	labelIdx := layer.Definition().FieldIndex(labelField)
 	if labelIdx < 0 {
-		err = fmt.Errorf(ErrColumnMissingTemplate, labelField)
+		err = newFieldError(shp, layer, labelField, -1, ErrColumnMissing)
 		return
 	}
 	var (
 		feature *gdal.Feature
 		label   string
 		e       error
-		gc      []destroyable
 	)
-	defer func() {
-		for _, v := range gc {
-			v.Destroy()
-		}
-	}()
 	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
 			if mz != emptyGeometry && !mz.Contains(feature.Geometry()) {
 				layer.Delete(feature.FID())
-				continue
-			}
-			if !needUpdate {
-				continue
-			}
-			label = feature.FieldAsString(labelIdx)
-			feature.SetFieldString(labelIdx, alignRet[label][0])
-			if e = layer.SetFeature(*feature); e != nil {
-				log.Error(g.logTag+"err in set feature of layer", zap.Error(e))
+			} else if needUpdate {
+				label = feature.FieldAsString(labelIdx)
+				feature.SetFieldString(labelIdx, alignRet[label][0])
+				if e = layer.SetFeature(*feature); e != nil {
+					g.logger.Error(g.logTag+"err in set feature of layer", zap.Error(e))
+				}
 			}
+			feature.Destroy() // 逐个释放要素
 		} else {
 			return
 		}
 	}
 }
 
-func (g *GdalToolbox) getShpDriver(shp string, srid int) (ds gdal.DataSource, ref gdal.SpatialReference, layer gdal.Layer, err error) {
-	log.Info(g.logTag+"output shp files", zap.String("shp", shp), zap.Int("srid", srid))
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Create(shp, nil)
-	if !ok {
-		err = ErrGdalDriverCreate
-		return
-	}
-	if ref, err = g.getSridRef(srid); err != nil {
-		return
-	}
-	layer = ds.CreateLayer("", ref, gdal.GT_Unknown, []string{ENCODING_OPTION})
-	return
-}
-
 func (g *GdalToolbox) initShpLayer(layer gdal.Layer, labelField string) (err error) {
-	log.Info(g.logTag+"init shp layer", zap.String("labelField", labelField))
+	g.logger.Info(g.logTag+"init shp layer", zap.String("labelField", labelField))
 	objectLabel := gdal.CreateFieldDefinition(labelField, gdal.FT_String)
 	objectLabel.SetWidth(64)
 	err = layer.CreateField(objectLabel, false)
 	return
 }
 
-// 将选定矢量WKB写入shp
+// 将选定矢量WKB写入shp（也可输出gpkg、geojson、fgb、csv，格式由扩展名推断；需指定格式或严格写入时使用WriteGeoToShapefileContext）
 func (g *GdalToolbox) WriteGeoToShapefile(shp string, srid int, gs ...GdalGeo) (err error) {
-	ref, err := g.getSridRef(srid)
-	if err != nil {
-		return
-	}
-	ds, _, layer, err := g.getShpDriver(shp, srid)
+	return g.WriteGeoToShapefileContext(context.Background(), shp, srid, gs)
+}
+
+// 将选定矢量WKB写入矢量文件（可通过ctx取消，取消时删除未写完的文件；可通过WithFormat指定格式，WithStrict严格写入）
+func (g *GdalToolbox) WriteGeoToShapefileContext(ctx context.Context, shp string, srid int, gs []GdalGeo, opts ...VectorOption) (err error) {
+	w, ds, ref, layer, err := g.createWriter(shp, EPSG(srid), opts)
 	if err != nil {
 		return
 	}
-	defer ds.Destroy() // 生成shp文件 + 释放资源
+	defer ref.Release()
+	defer g.closeWriter(ctx, w, ds, &err) // 生成矢量文件 + 释放资源
 	var (
 		def     = layer.Definition()
 		feature gdal.Feature
@@ -445,47 +521,76 @@ func (g *GdalToolbox) WriteGeoToShapefile(shp string, srid int, gs ...GdalGeo) (
 		e       error
 		gc      = make([]destroyable, len(gs))
 	)
+	defer func() {
+		for _, v := range gc {
+			if v != nil {
+				v.Destroy()
+			}
+		}
+	}()
 	for i, v := range gs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		feature = def.Create()
 		gc[i] = feature
-		e = feature.SetFID(int64(i))
-		if e != nil {
-			log.Error(g.logTag+"err in set feature fid", zap.Error(e))
+		if e = feature.SetFID(int64(i)); e != nil {
+			g.logger.Error(g.logTag+"err in set feature fid", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		if geo, e = g.parseWKB(v, ref); e != nil {
+			w.fail(i, e)
 			continue
 		}
-		e = feature.SetGeometryDirectly(geo)
-		if e != nil {
-			log.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+		if e = feature.SetGeometryDirectly(geo); e != nil {
+			g.logger.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
-		if e = layer.Create(feature); e != nil {
-			log.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+		if e = g.withCPL("CreateFeature", func() error { return layer.Create(feature) }); e != nil {
+			g.logger.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		valid++
 	}
-	for _, v := range gc {
-		v.Destroy()
-	}
-	log.Info(g.logTag+"output geo to shapefile done", zap.String("shp", shp), zap.Int("total", len(gs)), zap.Int("valid", valid))
+	g.logger.Info(g.logTag+"output geo to shapefile done", zap.String("shp", shp), zap.Int("total", len(gs)), zap.Int("valid", valid))
 	return
 }
 
-// 将选定图斑矢量写入shp
+// 将选定图斑矢量（含属性字段）写入shp（也可输出gpkg、geojson、fgb、csv，格式由扩展名推断；需指定格式或严格写入时使用WriteShapefileContext）
 func (g *GdalToolbox) WriteShapefile(shp, labelField string, srid int, speckles ...Speckle) (err error) {
-	ds, ref, layer, err := g.getShpDriver(shp, srid)
+	return g.WriteShapefileContext(context.Background(), shp, labelField, srid, speckles)
+}
+
+// 将选定图斑矢量写入矢量文件（可通过ctx取消，取消时删除未写完的文件；可通过WithFormat指定格式，WithStrict严格写入）
+func (g *GdalToolbox) WriteShapefileContext(ctx context.Context, shp, labelField string, srid int, speckles []Speckle, opts ...VectorOption) (err error) {
+	return g.WriteShapefileCRSContext(ctx, shp, labelField, EPSG(srid), speckles, opts...)
+}
+
+// 按任意坐标系定义（如无EPSG编码的WKT）将选定图斑矢量写入矢量文件，其余同WriteShapefile
+func (g *GdalToolbox) WriteShapefileCRS(shp, labelField string, crs CRS, speckles []Speckle, opts ...VectorOption) (err error) {
+	return g.WriteShapefileCRSContext(context.Background(), shp, labelField, crs, speckles, opts...)
+}
+
+// 按任意坐标系定义将选定图斑矢量写入矢量文件（可通过ctx取消）
+func (g *GdalToolbox) WriteShapefileCRSContext(ctx context.Context, shp, labelField string, crs CRS, speckles []Speckle, opts ...VectorOption) (err error) {
+	w, ds, ref, layer, err := g.createWriter(shp, crs, opts)
 	if err != nil {
 		return
 	}
-	defer ds.Destroy() // 生成shp文件 + 释放资源
+	defer ref.Release()
+	defer g.closeWriter(ctx, w, ds, &err) // 生成矢量文件 + 释放资源
 	if labelField != "" {
 		if err = g.initShpLayer(layer, labelField); err != nil {
 			return
 		}
 	}
+	attrIdx, err := g.initAttrFields(layer, labelField, speckles)
+	if err != nil {
+		return
+	}
 	var (
 		def = layer.Definition()
 		// uidIdx = def.FieldIndex(SHP_FIELD_UID)
@@ -499,44 +604,61 @@ func (g *GdalToolbox) WriteShapefile(shp, labelField string, srid int, speckles
 	if labelField != "" {
 		labelIdx = def.FieldIndex(labelField)
 	}
+	defer func() {
+		for _, v := range gc {
+			if v != nil {
+				v.Destroy()
+			}
+		}
+	}()
 	for i, vec := range speckles {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		feature = def.Create()
 		gc[i] = feature
-		e = feature.SetFID(int64(i))
-		if e != nil {
-			log.Error(g.logTag+"err in set feature fid", zap.Error(e))
+		if e = feature.SetFID(int64(i)); e != nil {
+			g.logger.Error(g.logTag+"err in set feature fid", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		if labelIdx >= 0 {
 			feature.SetFieldString(labelIdx, vec.ClassName)
 		}
+		setAttrs(feature, attrIdx, vec.Attrs)
 		if geo, e = g.parseWKB(vec.Geom, ref); e != nil {
+			w.fail(i, e)
 			continue
 		}
 		if e = feature.SetGeometryDirectly(geo); e != nil {
-			log.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+			g.logger.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
-		if e = layer.Create(feature); e != nil {
-			log.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+		if e = g.withCPL("CreateFeature", func() error { return layer.Create(feature) }); e != nil {
+			g.logger.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		cnt++
 	}
-	for _, v := range gc {
-		v.Destroy()
-	}
-	log.Info(g.logTag+"shp files created", zap.String("shp", shp), zap.Int("total", len(speckles)), zap.Int("valid", cnt))
+	g.logger.Info(g.logTag+"shp files created", zap.String("shp", shp), zap.Int("total", len(speckles)), zap.Int("valid", cnt))
 	return
 }
 
-// 将选定区域矢量写入shp
+// 将选定区域矢量写入shp（也可输出gpkg、geojson、fgb、csv，格式由扩展名推断；需指定格式或严格写入时使用WriteZoneShapefileContext）
 func (g *GdalToolbox) WriteZoneShapefile(shp string, srid int, ucs ...Uncertainty) (err error) {
-	ds, ref, layer, err := g.getShpDriver(shp, srid)
+	return g.WriteZoneShapefileContext(context.Background(), shp, srid, ucs)
+}
+
+// 将选定区域矢量写入矢量文件（可通过ctx取消，取消时删除未写完的文件；可通过WithFormat指定格式，WithStrict严格写入）
+func (g *GdalToolbox) WriteZoneShapefileContext(ctx context.Context, shp string, srid int, ucs []Uncertainty, opts ...VectorOption) (err error) {
+	w, ds, ref, layer, err := g.createWriter(shp, EPSG(srid), opts)
 	if err != nil {
 		return
 	}
-	defer ds.Destroy() // 生成shp文件 + 释放资源
+	defer ref.Release()
+	defer g.closeWriter(ctx, w, ds, &err) // 生成矢量文件 + 释放资源
 	objectOid := gdal.CreateFieldDefinition(SHP_FIELD_OID, gdal.FT_Integer)
 	if err = layer.CreateField(objectOid, false); err != nil {
 		return
@@ -549,54 +671,70 @@ func (g *GdalToolbox) WriteZoneShapefile(shp string, srid int, ucs ...Uncertaint
 		e       error
 		gc      = make([]destroyable, len(ucs))
 	)
+	defer func() {
+		for _, v := range gc {
+			if v != nil {
+				v.Destroy()
+			}
+		}
+	}()
 	for i, vec := range ucs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		feature = def.Create()
 		gc[i] = feature
-		e = feature.SetFID(int64(i))
-		if e != nil {
-			log.Error(g.logTag+"err in set feature fid", zap.Error(e))
+		if e = feature.SetFID(int64(i)); e != nil {
+			g.logger.Error(g.logTag+"err in set feature fid", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		feature.SetFieldInteger(0, vec.Id)
 		if geo, e = g.parseWKB(vec.Geom, ref); e != nil {
+			w.fail(i, e)
 			continue
 		}
-		e = feature.SetGeometryDirectly(geo)
-		if e != nil {
-			log.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+		if e = feature.SetGeometryDirectly(geo); e != nil {
+			g.logger.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
-		if e = layer.Create(feature); e != nil {
-			log.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+		if e = g.withCPL("CreateFeature", func() error { return layer.Create(feature) }); e != nil {
+			g.logger.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		cnt++
 	}
-	for _, v := range gc {
-		v.Destroy()
-	}
-	log.Info(g.logTag+"zone shp files created", zap.String("shp", shp), zap.Int("total", len(ucs)), zap.Int("valid", cnt))
+	g.logger.Info(g.logTag+"zone shp files created", zap.String("shp", shp), zap.Int("total", len(ucs)), zap.Int("valid", cnt))
 	return
 }
 
-// 将图斑合并区域矢量写入shp
-func (g *GdalToolbox) WriteMergedShapefile(shp string, uc Uncertainty) (err error) {
+// 将图斑合并区域矢量写入shp（也可输出gpkg、geojson、fgb、csv，格式由扩展名推断；可通过WithFormat指定格式，WithStrict严格写入）
+func (g *GdalToolbox) WriteMergedShapefile(shp string, uc Uncertainty, opts ...VectorOption) (err error) {
+	return g.WriteMergedShapefileContext(context.Background(), shp, uc, opts...)
+}
+
+// 将图斑合并区域矢量写入矢量文件（可通过ctx取消，取消时删除未写完的文件；可通过WithFormat指定格式，WithStrict严格写入）
+func (g *GdalToolbox) WriteMergedShapefileContext(ctx context.Context, shp string, uc Uncertainty, opts ...VectorOption) (err error) {
 	sRef, err := g.getSridRef(GEOJSON_SRID)
 	if err != nil {
 		return
 	}
+	defer sRef.Release()
 	ucGeo, err := g.parseWKB(uc.Geom, sRef)
 	if err != nil {
 		return
 	}
 	defer ucGeo.Destroy()
-	ds, tRef, layer, err := g.getShpDriver(shp, OUTPUT_SRID)
+	w, ds, tRef, layer, err := g.createWriter(shp, EPSG(g.outputSrid), opts)
 	if err != nil {
 		return
 	}
-	defer ds.Destroy() // 生成shp文件 + 释放资源
+	defer tRef.Release()
+	defer g.closeWriter(ctx, w, ds, &err) // 生成矢量文件 + 释放资源
 	if err = ucGeo.TransformTo(tRef); err != nil {
-		log.Error(g.logTag+"geo transform failed", zap.Error(err))
+		g.logger.Error(g.logTag+"geo transform failed", zap.Error(err))
 		return
 	}
 	var polygons []gdal.Geometry
@@ -620,27 +758,36 @@ func (g *GdalToolbox) WriteMergedShapefile(shp string, uc Uncertainty) (err erro
 		e       error
 		gc      = make([]destroyable, len(polygons))
 	)
+	defer func() {
+		for _, v := range gc {
+			if v != nil {
+				v.Destroy()
+			}
+		}
+	}()
 	for i := range polygons {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		feature = def.Create()
 		gc[i] = feature
-		e = feature.SetFID(int64(i))
-		if e != nil {
-			log.Error(g.logTag+"err in set feature fid", zap.Error(e))
+		if e = feature.SetFID(int64(i)); e != nil {
+			g.logger.Error(g.logTag+"err in set feature fid", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		if e = feature.SetGeometry(polygons[i]); e != nil {
-			log.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+			g.logger.Error(g.logTag+"err in set geom of feature", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
-		if e = layer.Create(feature); e != nil {
-			log.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+		if e = g.withCPL("CreateFeature", func() error { return layer.Create(feature) }); e != nil {
+			g.logger.Error(g.logTag+"err in create feature of layer", zap.Error(e))
+			w.fail(i, e)
 			continue
 		}
 		cnt++
 	}
-	for _, v := range gc {
-		v.Destroy()
-	}
-	log.Info(g.logTag+"merged zone shp files created", zap.String("shp", shp), zap.Int("total", len(polygons)), zap.Int("valid", cnt))
+	g.logger.Info(g.logTag+"merged zone shp files created", zap.String("shp", shp), zap.Int("total", len(polygons)), zap.Int("valid", cnt))
 	return
 }
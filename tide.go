@@ -1,10 +1,9 @@
 package gdalib
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/lukeroth/gdal"
-	"github.com/wgdzlh/gdalib/log"
 	"github.com/wgdzlh/gdalib/utils"
 	"go.uber.org/zap"
 )
@@ -15,20 +14,22 @@ var (
 )
 
 // 解析tide site shp文件
-func (g *GdalToolbox) ParseTideSiteShp(shp string) (ret []TideSpeckle, err error) {
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+func (g *GdalToolbox) ParseTideSiteShp(shp string, opts ...VectorOption) (ret []TideSpeckle, err error) {
+	return g.ParseTideSiteShpContext(context.Background(), shp, opts...)
+}
+
+// 解析tide site shp文件（可通过ctx取消）
+func (g *GdalToolbox) ParseTideSiteShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret []TideSpeckle, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	layer := ds.LayerByIndex(0)
 	def := layer.Definition()
 	idIdx := def.FieldIndex(SHP_FIELD_SID)
 	if idIdx < 0 {
 		if idIdx = def.FieldIndex(fieldIdGbk); idIdx < 0 {
-			err = fmt.Errorf(ErrColumnMissingTemplate, SHP_FIELD_SID)
+			err = newFieldError(shp, layer, SHP_FIELD_SID, -1, ErrColumnMissing)
 			return
 		}
 	}
@@ -42,31 +43,30 @@ func (g *GdalToolbox) ParseTideSiteShp(shp string) (ret []TideSpeckle, err error
 		feature *gdal.Feature
 		wkb     []byte
 		idStr   string
+		fid     int64
 		e       error
-		gc      []destroyable
 	)
-	defer func() {
-		for _, v := range gc {
-			v.Destroy()
-		}
-	}()
 	for {
+		if err = ctx.Err(); err != nil {
+			ret = nil
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
 			wkb, e = feature.Geometry().ToWKB()
+			idStr, fid = feature.FieldAsString(idIdx), feature.FID()
+			feature.Destroy() // 逐个释放要素，避免大文件解析时内存随要素数线性增长
 			if len(wkb) < 3 || e != nil {
-				log.Error(g.logTag+"err in wkb trans", zap.Int64("fid", feature.FID()), zap.Error(e))
+				g.logger.Error(g.logTag+"err in wkb trans", zap.Int64("fid", fid), zap.Error(e))
 				continue
 			}
-			idStr = feature.FieldAsString(idIdx)
 			if idStr == "" {
-				log.Error(g.logTag+"empty id str", zap.Int64("fid", feature.FID()))
+				g.logger.Error(g.logTag+"empty id str", zap.Int64("fid", fid))
 				continue
 			}
 			// label = feature.FieldAsString(labelIdx)
 			// if !utf8 {
 			// 	if label, e = utils.GbkStrToUtf8(label); e != nil {
-			// 		log.Error(g.logTag+"err in trans-encoding label", zap.Int64("fid", feature.FID()), zap.Error(e))
+			// 		g.logger.Error(g.logTag+"err in trans-encoding label", zap.Int64("fid", feature.FID()), zap.Error(e))
 			// 		continue
 			// 	}
 			// }
@@ -82,19 +82,21 @@ func (g *GdalToolbox) ParseTideSiteShp(shp string) (ret []TideSpeckle, err error
 }
 
 // 解析tide span shp文件
-func (g *GdalToolbox) ParseTideSpanShp(shp string) (ret []TideSpan, err error) {
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+func (g *GdalToolbox) ParseTideSpanShp(shp string, opts ...VectorOption) (ret []TideSpan, err error) {
+	return g.ParseTideSpanShpContext(context.Background(), shp, opts...)
+}
+
+// 解析tide span shp文件（可通过ctx取消）
+func (g *GdalToolbox) ParseTideSpanShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret []TideSpan, err error) {
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	layer := ds.LayerByIndex(0)
 	def := layer.Definition()
 	idIdx := def.FieldIndex(SHP_FIELD_ID)
 	if idIdx < 0 {
-		err = fmt.Errorf(ErrColumnMissingTemplate, SHP_FIELD_ID)
+		err = newFieldError(shp, layer, SHP_FIELD_ID, -1, ErrColumnMissing)
 		return
 	}
 	ret = []TideSpan{}
@@ -102,25 +104,24 @@ func (g *GdalToolbox) ParseTideSpanShp(shp string) (ret []TideSpan, err error) {
 		feature *gdal.Feature
 		wkt     string
 		idStr   string
+		fid     int64
 		e       error
-		gc      []destroyable
 	)
-	defer func() {
-		for _, v := range gc {
-			v.Destroy()
-		}
-	}()
 	for {
+		if err = ctx.Err(); err != nil {
+			ret = nil
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
 			wkt, e = feature.Geometry().ToWKT()
+			idStr, fid = feature.FieldAsString(idIdx), feature.FID()
+			feature.Destroy() // 逐个释放要素
 			if e != nil {
-				log.Error(g.logTag+"err in wkt trans", zap.Int64("fid", feature.FID()), zap.Error(e))
+				g.logger.Error(g.logTag+"err in wkt trans", zap.Int64("fid", fid), zap.Error(e))
 				continue
 			}
-			idStr = feature.FieldAsString(idIdx)
 			if idStr == "" {
-				log.Error(g.logTag+"empty id str", zap.Int64("fid", feature.FID()))
+				g.logger.Error(g.logTag+"empty id str", zap.Int64("fid", fid))
 				continue
 			}
 			ret = append(ret, TideSpan{
@@ -134,27 +135,27 @@ func (g *GdalToolbox) ParseTideSpanShp(shp string) (ret []TideSpan, err error) {
 }
 
 // 解析镶嵌Shp
-func (g *GdalToolbox) GetGeoFromInlayShp(shp string) (rets []InlayShpGeo, err error) {
-	log.Info(g.logTag+"start parse inlay shp", zap.String("shp", shp))
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+func (g *GdalToolbox) GetGeoFromInlayShp(shp string, opts ...VectorOption) (rets []InlayShpGeo, err error) {
+	return g.GetGeoFromInlayShpContext(context.Background(), shp, opts...)
+}
+
+// 解析镶嵌Shp（可通过ctx取消）
+func (g *GdalToolbox) GetGeoFromInlayShpContext(ctx context.Context, shp string, opts ...VectorOption) (rets []InlayShpGeo, err error) {
+	g.logger.Info(g.logTag+"start parse inlay shp", zap.String("shp", shp))
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	var (
-		layer = ds.LayerByIndex(0)
-		trans gdal.CoordinateTransform
-	)
+	var trans gdal.CoordinateTransform
 	sRef := layer.SpatialReference()
-	srid, err := g.getSrid(sRef)
+	srid, err := g.getLayerSrid(sRef)
 	if err != nil {
 		return
 	}
 	tifIdx := layer.Definition().FieldIndex(SHP_FIELD_TIF)
 	if tifIdx < 0 {
-		err = fmt.Errorf(ErrColumnMissingTemplate, SHP_FIELD_TIF)
+		err = newFieldError(shp, layer, SHP_FIELD_TIF, -1, ErrColumnMissing)
 		return
 	}
 	var (
@@ -162,6 +163,8 @@ func (g *GdalToolbox) GetGeoFromInlayShp(shp string) (rets []InlayShpGeo, err er
 		wkb     []byte
 		tif     string
 		geo     gdal.Geometry
+		fid     int64
+		e       error
 		gc      []destroyable
 	)
 	defer func() {
@@ -176,22 +179,30 @@ func (g *GdalToolbox) GetGeoFromInlayShp(shp string) (rets []InlayShpGeo, err er
 			return
 		}
 		trans = gdal.CreateCoordinateTransform(sRef, tRef)
+		tRef.Release()
 		gc = append(gc, trans)
 	}
 	for {
+		if err = ctx.Err(); err != nil {
+			rets = nil
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
-			geo = feature.Geometry()
+			geo, e = feature.Geometry(), nil
 			if needTrans {
-				if err = geo.Transform(trans); err != nil {
-					return
-				}
+				e = g.withCPL("Transform", func() error { return geo.Transform(trans) })
 			}
-			if wkb, err = geo.ToWKB(); err != nil {
+			if e == nil {
+				wkb, e = geo.ToWKB()
+			}
+			tif, fid = feature.FieldAsString(tifIdx), feature.FID()
+			feature.Destroy() // 逐个释放要素（geo归要素所有，一并释放）
+			if e != nil {
+				err = newFeatureError(shp, layer, fid, e)
 				return
 			}
-			if tif = feature.FieldAsString(tifIdx); tif == "" {
-				err = fmt.Errorf(ErrColumnEmptyTemplate, SHP_FIELD_TIF)
+			if tif == "" {
+				err = newFieldError(shp, layer, SHP_FIELD_TIF, fid, ErrColumnEmpty)
 				return
 			}
 			rets = append(rets, InlayShpGeo{
@@ -202,25 +213,20 @@ func (g *GdalToolbox) GetGeoFromInlayShp(shp string) (rets []InlayShpGeo, err er
 			break
 		}
 	}
-	log.Info(g.logTag+"got geo from inlay shp", zap.String("shp", shp), zap.Int("srid", srid), zap.Int("geo_num", len(rets)))
+	g.logger.Info(g.logTag+"got geo from inlay shp", zap.String("shp", shp), zap.Int("srid", srid), zap.Int("geo_num", len(rets)))
 	return
 }
 
-func (g *GdalToolbox) getGeoFromScatteredShp(shp string) (mergedGeo gdal.Geometry, srid, pCnt int, err error) {
+func (g *GdalToolbox) getGeoFromScatteredShp(ctx context.Context, shp string, opts ...VectorOption) (mergedGeo gdal.Geometry, srid, pCnt int, err error) {
 	mergedGeo = gdal.Create(gdal.GT_MultiPolygon)
-	driver := gdal.OGRDriverByName(SHP_DRIVER_NAME)
-	ds, ok := driver.Open(shp, 0)
-	if !ok {
-		err = ErrGdalDriverOpen
+	ds, layer, err := g.openVector(shp, false, opts...)
+	if err != nil {
 		return
 	}
 	defer ds.Destroy()
-	var (
-		layer = ds.LayerByIndex(0)
-		trans gdal.CoordinateTransform
-	)
+	var trans gdal.CoordinateTransform
 	sRef := layer.SpatialReference()
-	srid, err = g.getSrid(sRef)
+	srid, err = g.getLayerSrid(sRef)
 	if err != nil {
 		return
 	}
@@ -241,14 +247,18 @@ func (g *GdalToolbox) getGeoFromScatteredShp(shp string) (mergedGeo gdal.Geometr
 			return
 		}
 		trans = gdal.CreateCoordinateTransform(sRef, tRef)
+		tRef.Release()
 		gc = append(gc, trans)
 	}
 	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		if feature = layer.NextFeature(); feature != nil {
-			gc = append(gc, *feature)
 			geo = feature.StealGeometry()
+			feature.Destroy() // 几何已取出，逐个释放要素
 			if needTrans {
-				if err = geo.Transform(trans); err != nil {
+				if err = g.withCPL("Transform", func() error { return geo.Transform(trans) }); err != nil {
 					return
 				}
 			}
@@ -283,34 +293,46 @@ func (g *GdalToolbox) getGeoFromScatteredShp(shp string) (mergedGeo gdal.Geometr
 	return
 }
 
-func (g *GdalToolbox) GetEWktFromScatteredShp(shp string) (ret string, err error) {
-	wkt, err := g.GetWktFromScatteredShp(shp)
+func (g *GdalToolbox) GetEWktFromScatteredShp(shp string, opts ...VectorOption) (ret string, err error) {
+	return g.GetEWktFromScatteredShpContext(context.Background(), shp, opts...)
+}
+
+func (g *GdalToolbox) GetEWktFromScatteredShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret string, err error) {
+	wkt, err := g.GetWktFromScatteredShpContext(ctx, shp, opts...)
 	if err != nil {
-		log.Error(g.logTag+"failed to get wkt from shp", zap.String("shp", shp), zap.Error(err))
+		g.logger.Error(g.logTag+"failed to get wkt from shp", zap.String("shp", shp), zap.Error(err))
 		return
 	}
 	ret = "SRID=4326;" + wkt
 	return
 }
 
-func (g *GdalToolbox) GetWktFromScatteredShp(shp string) (ret string, err error) {
-	log.Info(g.logTag+"start shp wkt trans", zap.String("shp", shp))
-	mg, srid, pCnt, err := g.getGeoFromScatteredShp(shp)
+func (g *GdalToolbox) GetWktFromScatteredShp(shp string, opts ...VectorOption) (ret string, err error) {
+	return g.GetWktFromScatteredShpContext(context.Background(), shp, opts...)
+}
+
+func (g *GdalToolbox) GetWktFromScatteredShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret string, err error) {
+	g.logger.Info(g.logTag+"start shp wkt trans", zap.String("shp", shp))
+	mg, srid, pCnt, err := g.getGeoFromScatteredShp(ctx, shp, opts...)
 	if pCnt > 0 {
 		ret, err = mg.ToWKT()
 	}
 	mg.Destroy()
-	log.Info(g.logTag+"got wkt from shp", zap.String("shp", shp), zap.Int("srid", srid), zap.Int("cnt", pCnt), zap.Error(err))
+	g.logger.Info(g.logTag+"got wkt from shp", zap.String("shp", shp), zap.Int("srid", srid), zap.Int("cnt", pCnt), zap.Error(err))
 	return
 }
 
-func (g *GdalToolbox) GetWkbFromScatteredShp(shp string) (ret []byte, err error) {
-	log.Info(g.logTag+"start shp wkb trans", zap.String("shp", shp))
-	mg, srid, pCnt, err := g.getGeoFromScatteredShp(shp)
+func (g *GdalToolbox) GetWkbFromScatteredShp(shp string, opts ...VectorOption) (ret []byte, err error) {
+	return g.GetWkbFromScatteredShpContext(context.Background(), shp, opts...)
+}
+
+func (g *GdalToolbox) GetWkbFromScatteredShpContext(ctx context.Context, shp string, opts ...VectorOption) (ret []byte, err error) {
+	g.logger.Info(g.logTag+"start shp wkb trans", zap.String("shp", shp))
+	mg, srid, pCnt, err := g.getGeoFromScatteredShp(ctx, shp, opts...)
 	if pCnt > 0 {
 		ret, err = mg.ToWKB()
 	}
 	mg.Destroy()
-	log.Info(g.logTag+"got wkb from shp", zap.String("shp", shp), zap.Int("srid", srid), zap.Int("cnt", pCnt), zap.Error(err))
+	g.logger.Info(g.logTag+"got wkb from shp", zap.String("shp", shp), zap.Int("srid", srid), zap.Int("cnt", pCnt), zap.Error(err))
 	return
 }
@@ -0,0 +1,71 @@
+package gdalib
+
+import (
+	"github.com/lukeroth/gdal"
+)
+
+// 级联合并器：先把所有面收集到一个MultiPolygon中，最后一次性UnionCascaded，
+// 避免逐个Union时结果越来越复杂导致的平方复杂度
+// 非面类型的几何在最后逐个合并到结果中
+type cascadedUnion struct {
+	polygons gdal.Geometry   // 收集到的面
+	others   []gdal.Geometry // 非面几何
+}
+
+func newCascadedUnion() *cascadedUnion {
+	return &cascadedUnion{polygons: gdal.Create(gdal.GT_MultiPolygon)}
+}
+
+// 加入几何（复制，geo仍归调用方所有）
+func (u *cascadedUnion) add(geo gdal.Geometry) {
+	if geo.IsNull() {
+		return
+	}
+	// 25D面同样按面收集（合并结果随之提升为25D）
+	switch flatType(geo) {
+	case gdal.GT_Polygon:
+		u.polygons.AddGeometry(geo)
+	case gdal.GT_MultiPolygon:
+		for i := 0; i < geo.GeometryCount(); i++ {
+			u.polygons.AddGeometry(geo.Geometry(i))
+		}
+	default:
+		if !geo.IsEmpty() {
+			u.others = append(u.others, geo.Clone())
+		}
+	}
+}
+
+// 加入几何并接管其所有权（geo无需调用方回收）
+func (u *cascadedUnion) addDirectly(geo gdal.Geometry) {
+	if flatType(geo) == gdal.GT_Polygon {
+		u.polygons.AddGeometryDirectly(geo)
+		return
+	}
+	u.add(geo)
+	geo.Destroy()
+}
+
+// 计算合并结果（需调用方Destroy）
+func (u *cascadedUnion) union() (ret gdal.Geometry) {
+	if u.polygons.GeometryCount() > 0 {
+		ret = u.polygons.UnionCascaded()
+	} else {
+		ret = gdal.Create(gdal.GT_Polygon)
+	}
+	for _, geo := range u.others {
+		next := ret.Union(geo)
+		ret.Destroy()
+		ret = next
+	}
+	return
+}
+
+// 释放已收集的几何
+func (u *cascadedUnion) Destroy() {
+	u.polygons.Destroy()
+	for _, geo := range u.others {
+		geo.Destroy()
+	}
+	u.others = nil
+}
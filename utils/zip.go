@@ -4,10 +4,13 @@ import (
 	"archive/zip"
 	"errors"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"unicode/utf8"
+
+	"github.com/wgdzlh/gdalib/log"
+
+	"go.uber.org/zap"
 )
 
 const (
@@ -42,7 +45,7 @@ func CompressZip(dest, srcDir string) (err error) {
 	defer w.Close()
 
 	walker := func(path string, info os.FileInfo, e error) error {
-		log.Println("zip crawling: " + path)
+		log.Debug("zip crawling", zap.String("path", path))
 		if e != nil || info.IsDir() {
 			return e
 		}
@@ -61,7 +64,7 @@ func CompressZip(dest, srcDir string) (err error) {
 		return e
 	}
 	err = filepath.Walk(srcDir, walker)
-	log.Println("zip created: " + dest)
+	log.Info("zip created", zap.String("dest", dest))
 	return
 }
 
@@ -86,7 +89,7 @@ func CompressFiles(dest string, src ...string) (err error) {
 		zfw  io.Writer
 	)
 	for _, path := range src {
-		log.Println("zip crawling: " + path)
+		log.Debug("zip crawling", zap.String("path", path))
 		file, err = os.Open(path)
 		if err != nil {
 			return
@@ -102,7 +105,7 @@ func CompressFiles(dest string, src ...string) (err error) {
 			return
 		}
 	}
-	log.Println("zip created: " + dest)
+	log.Info("zip created", zap.String("dest", dest))
 	return
 }
 
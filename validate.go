@@ -0,0 +1,473 @@
+package gdalib
+
+import (
+	"bytes"
+	"math"
+	"sort"
+
+	"github.com/wgdzlh/gdalib/utils"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 几何无效原因
+const (
+	ReasonInvalidCoordinate = "invalid coordinate"     // 坐标为NaN或Inf
+	ReasonTooFewPoints      = "too few points"         // 环的点数不足4个
+	ReasonRingNotClosed     = "ring not closed"        // 环首尾不闭合
+	ReasonSelfIntersection  = "self-intersection"      // 边自相交（含蝴蝶结形、环间交叉）
+	ReasonInvalidTopology   = "invalid topology"       // 其他拓扑错误（如洞在外环之外、面相互重叠），由GEOS判定
+	WarnDuplicatePoints     = "duplicate points"       // 相邻重复顶点（不影响有效性）
+	WarnRingOrientation     = "wrong ring orientation" // 外环非逆时针或内环非顺时针（不影响有效性）
+)
+
+// 几何有效性检查结果
+type Validity struct {
+	Valid    bool      `json:"valid"`              // 是否有效（OGC简单要素规范）
+	Reason   string    `json:"reason,omitempty"`   // 无效原因
+	Location []float64 `json:"location,omitempty"` // 问题位置[x, y]，未知时为空
+	Warnings []string  `json:"warnings,omitempty"` // 不影响有效性的问题
+}
+
+// 几何数据格式
+type geomFormat int
+
+const (
+	geomWKB geomFormat = iota
+	geomWKT
+	geomGeoJSON
+)
+
+// 按内容判断几何数据格式：WKB首字节为字节序标志0或1，GeoJSON以{开头，其余按WKT处理
+func detectGeomFormat(data []byte) geomFormat {
+	if len(data) > 0 && (data[0] == 0 || data[0] == 1) {
+		return geomWKB
+	}
+	if t := bytes.TrimSpace(data); len(t) > 0 && t[0] == '{' {
+		return geomGeoJSON
+	}
+	return geomWKT
+}
+
+func (g *GdalToolbox) parseAnyGeo(data []byte) (geo gdal.Geometry, format geomFormat, err error) {
+	switch format = detectGeomFormat(data); format {
+	case geomWKB:
+		geo, err = g.parseWKB(data, gdal.SpatialReference{})
+	case geomGeoJSON:
+		if geo = gdal.CreateFromJson(utils.B2S(data)); geo.IsNull() {
+			err = ErrGdalWrongGeoJSON
+		}
+	default:
+		geo, err = g.parseWKT(utils.B2S(data), gdal.SpatialReference{})
+	}
+	return
+}
+
+func exportGeo(geo gdal.Geometry, format geomFormat) (ret []byte, err error) {
+	switch format {
+	case geomWKB:
+		ret, err = geo.ToWKB()
+	case geomGeoJSON:
+		ret = utils.S2B(geo.ToJSON())
+	default:
+		var wkt string
+		wkt, err = geo.ToWKT()
+		ret = utils.S2B(wkt)
+	}
+	return
+}
+
+// 检查几何有效性，geom可为WKB、WKT或GeoJSON（自动识别）
+func (g *GdalToolbox) ValidateGeometry(geom []byte) (v Validity, err error) {
+	geo, _, err := g.parseAnyGeo(geom)
+	if err != nil {
+		return
+	}
+	defer geo.Destroy()
+	v = validateGeo(geo)
+	return
+}
+
+// 检查WKT有效性（含拓扑有效性）
+func (g *GdalToolbox) ValidateWkt(wkt string) (v Validity, err error) {
+	return g.ValidateGeometry(utils.S2B(wkt))
+}
+
+// 修复几何，geom可为WKB、WKT或GeoJSON（自动识别），以相同格式输出
+// 依次进行：去除相邻重复顶点、闭合环、MakeValid（失败时对面做buffer(0)）、外环逆时针/内环顺时针定向
+func (g *GdalToolbox) RepairGeometry(geom []byte) (ret []byte, err error) {
+	geo, format, err := g.parseAnyGeo(geom)
+	if err != nil {
+		return
+	}
+	defer geo.Destroy()
+	fixed, err := g.repairGeo(geo)
+	if err != nil {
+		return
+	}
+	defer fixed.Destroy()
+	return exportGeo(fixed, format)
+}
+
+// 修复WKT
+func (g *GdalToolbox) RepairWkt(wkt string) (ret string, err error) {
+	out, err := g.RepairGeometry(utils.S2B(wkt))
+	ret = string(out)
+	return
+}
+
+func isPolygonal(gt gdal.GeometryType) bool {
+	return gt == gdal.GT_Polygon || gt == gdal.GT_MultiPolygon
+}
+
+// 面（或多面）中的各个面
+func polygonsOf(geo gdal.Geometry) (polygons []gdal.Geometry) {
+	switch flatType(geo) {
+	case gdal.GT_Polygon:
+		polygons = []gdal.Geometry{geo}
+	case gdal.GT_MultiPolygon, gdal.GT_GeometryCollection:
+		for i := 0; i < geo.GeometryCount(); i++ {
+			polygons = append(polygons, polygonsOf(geo.Geometry(i))...)
+		}
+	}
+	return
+}
+
+func validateGeo(geo gdal.Geometry) (v Validity) {
+	v.Valid = true
+	if isPolygonal(flatType(geo)) {
+		var dup, orient bool
+		for _, p := range polygonsOf(geo) {
+			var segs []segment
+			for i := 0; i < p.GeometryCount(); i++ {
+				r := readRing(p.Geometry(i))
+				if loc, ok := r.invalidCoord(); ok {
+					v.setInvalid(ReasonInvalidCoordinate, loc)
+					return
+				}
+				if len(r) < 4 {
+					v.setInvalid(ReasonTooFewPoints, r.first())
+					return
+				}
+				if r[0] != r[len(r)-1] {
+					v.setInvalid(ReasonRingNotClosed, r.first())
+					return
+				}
+				if r.hasDuplicates() {
+					dup = true
+				}
+				if (i == 0) != (r.signedArea() > 0) {
+					orient = true
+				}
+				segs = append(segs, r.segments(i)...)
+			}
+			if loc, ok := findSelfIntersection(segs); ok {
+				v.setInvalid(ReasonSelfIntersection, loc)
+				return
+			}
+		}
+		if dup {
+			v.Warnings = append(v.Warnings, WarnDuplicatePoints)
+		}
+		if orient {
+			v.Warnings = append(v.Warnings, WarnRingOrientation)
+		}
+	}
+	if !geo.IsValid() {
+		v.setInvalid(ReasonInvalidTopology, nil)
+	}
+	return
+}
+
+func (v *Validity) setInvalid(reason string, loc []float64) {
+	v.Valid = false
+	v.Reason = reason
+	v.Location = loc
+}
+
+// 修复几何，返回的新几何需调用方Destroy
+func (g *GdalToolbox) repairGeo(geo gdal.Geometry) (ret gdal.Geometry, err error) {
+	polygonal := isPolygonal(flatType(geo))
+	if polygonal {
+		ret = rebuildPolygons(geo)
+	} else {
+		ret = geo.Clone()
+	}
+	if !ret.IsValid() {
+		fixed, e := makeValid(ret)
+		if e == nil && !fixed.IsValid() {
+			fixed.Destroy()
+			e = ErrMakeValid
+		}
+		if e != nil {
+			if !polygonal {
+				ret.Destroy()
+				g.logger.Error(g.logTag+"make valid failed", zap.Error(e))
+				err = ErrRepairFailed
+				return
+			}
+			g.logger.Info(g.logTag+"make valid failed, fallback to buffer(0)", zap.Error(e))
+			fixed = ret.Buffer(0, BuffQuadSegs)
+		}
+		ret.Destroy()
+		ret = fixed
+	}
+	if polygonal {
+		// MakeValid的结果可能含线、点等退化部分，且环方向不定，只保留面并重新定向
+		fixed := rebuildPolygons(ret)
+		ret.Destroy()
+		ret = fixed
+		if !ret.IsValid() {
+			ret.Destroy()
+			err = ErrRepairFailed
+		}
+	}
+	return
+}
+
+// 去除重复顶点、闭合环、统一环方向后重建面（结果为二维Polygon或MultiPolygon，25D输入的Z值不保留），退化的环被丢弃
+func rebuildPolygons(geo gdal.Geometry) (ret gdal.Geometry) {
+	var polygons []gdal.Geometry
+	for _, p := range polygonsOf(geo) {
+		np := gdal.Create(gdal.GT_Polygon)
+		for i := 0; i < p.GeometryCount(); i++ {
+			r := readRing(p.Geometry(i)).normalize()
+			if len(r) < 4 {
+				continue
+			}
+			if (i == 0) != (r.signedArea() > 0) { // 外环逆时针，内环顺时针
+				r.reverse()
+			}
+			if i > 0 && np.GeometryCount() == 0 { // 外环退化时整个面丢弃
+				break
+			}
+			np.AddGeometryDirectly(r.build())
+		}
+		if np.GeometryCount() == 0 {
+			np.Destroy()
+			continue
+		}
+		polygons = append(polygons, np)
+	}
+	if len(polygons) == 1 && flatType(geo) == gdal.GT_Polygon {
+		ret = polygons[0]
+	} else {
+		ret = gdal.Create(gdal.GT_MultiPolygon)
+		for _, p := range polygons {
+			ret.AddGeometryDirectly(p)
+		}
+	}
+	ret.SetSpatialReference(geo.SpatialReference())
+	return
+}
+
+// 环上的点
+type ring [][2]float64
+
+func readRing(geo gdal.Geometry) ring {
+	n := geo.PointCount()
+	r := make(ring, n)
+	for i := range r {
+		r[i] = [2]float64{geo.X(i), geo.Y(i)}
+	}
+	return r
+}
+
+func (r ring) build() gdal.Geometry {
+	geo := gdal.Create(gdal.GT_LinearRing)
+	for _, pt := range r {
+		geo.AddPoint2D(pt[0], pt[1])
+	}
+	return geo
+}
+
+func (r ring) first() []float64 {
+	if len(r) == 0 {
+		return nil
+	}
+	return r[0][:]
+}
+
+func (r ring) invalidCoord() ([]float64, bool) {
+	for _, pt := range r {
+		for _, c := range pt {
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return []float64{pt[0], pt[1]}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (r ring) hasDuplicates() bool {
+	for i := 1; i < len(r); i++ {
+		if r[i] == r[i-1] {
+			return true
+		}
+	}
+	return false
+}
+
+// 去除相邻重复顶点并闭合
+func (r ring) normalize() (out ring) {
+	out = make(ring, 0, len(r)+1)
+	for i, pt := range r {
+		if i > 0 && pt == out[len(out)-1] {
+			continue
+		}
+		out = append(out, pt)
+	}
+	if len(out) > 0 && out[0] != out[len(out)-1] {
+		out = append(out, out[0])
+	}
+	return
+}
+
+// 有向面积，逆时针为正
+func (r ring) signedArea() (a float64) {
+	for i := 1; i < len(r); i++ {
+		a += r[i-1][0]*r[i][1] - r[i][0]*r[i-1][1]
+	}
+	return a / 2
+}
+
+func (r ring) reverse() {
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+}
+
+// 线段，ring为所属环序号，idx为在环中的序号，last为环中的最后一个序号
+type segment struct {
+	a, b            [2]float64
+	ring, idx, last int
+}
+
+func (r ring) segments(ringIdx int) (segs []segment) {
+	last := -1
+	for i := 1; i < len(r); i++ {
+		if r[i] != r[i-1] {
+			last++
+		}
+	}
+	idx := 0
+	for i := 1; i < len(r); i++ {
+		if r[i] == r[i-1] {
+			continue
+		}
+		segs = append(segs, segment{a: r[i-1], b: r[i], ring: ringIdx, idx: idx, last: last})
+		idx++
+	}
+	return
+}
+
+func (s segment) minX() float64 { return math.Min(s.a[0], s.b[0]) }
+func (s segment) maxX() float64 { return math.Max(s.a[0], s.b[0]) }
+
+// 是否为同一环中首尾相接的两条线段
+func (s segment) adjacent(o segment) bool {
+	if s.ring != o.ring {
+		return false
+	}
+	d := s.idx - o.idx
+	return d == 1 || d == -1 || (s.idx == 0 && o.idx == s.last) || (o.idx == 0 && s.idx == o.last)
+}
+
+// 按x排序扫描查找自相交，返回第一个交点
+func findSelfIntersection(segs []segment) ([]float64, bool) {
+	sort.Slice(segs, func(i, j int) bool {
+		return segs[i].minX() < segs[j].minX()
+	})
+	for i, s := range segs {
+		maxX := s.maxX()
+		for _, o := range segs[i+1:] {
+			if o.minX() > maxX {
+				break
+			}
+			if loc, ok := segmentsConflict(s, o); ok {
+				return loc, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// 判断两条线段是否构成无效相交：
+// 同一环中相邻线段只允许共享端点，不相邻线段不允许接触；不同环的线段不允许交叉或共线重叠（允许单点接触）
+func segmentsConflict(s, o segment) ([]float64, bool) {
+	d1 := orient(o.a, o.b, s.a)
+	d2 := orient(o.a, o.b, s.b)
+	d3 := orient(s.a, s.b, o.a)
+	d4 := orient(s.a, s.b, o.b)
+	if d1 == 0 && d2 == 0 { // 共线
+		lo, hi, ok := collinearOverlap(s, o)
+		if !ok {
+			return nil, false
+		}
+		if lo != hi || (!s.adjacent(o) && s.ring == o.ring) {
+			return lo[:], true
+		}
+		return nil, false
+	}
+	if (d1 > 0) != (d2 > 0) && d1 != 0 && d2 != 0 && (d3 > 0) != (d4 > 0) && d3 != 0 && d4 != 0 {
+		// 内部交叉
+		return intersectionPoint(s, o), true
+	}
+	if s.ring != o.ring || s.adjacent(o) {
+		return nil, false
+	}
+	// 同一环中不相邻线段的端点接触
+	for _, c := range []struct {
+		d  float64
+		pt [2]float64
+		sg segment
+	}{{d1, s.a, o}, {d2, s.b, o}, {d3, o.a, s}, {d4, o.b, s}} {
+		if c.d == 0 && onSegment(c.sg, c.pt) {
+			return []float64{c.pt[0], c.pt[1]}, true
+		}
+	}
+	return nil, false
+}
+
+func orient(a, b, c [2]float64) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+func onSegment(s segment, p [2]float64) bool {
+	return math.Min(s.a[0], s.b[0]) <= p[0] && p[0] <= math.Max(s.a[0], s.b[0]) &&
+		math.Min(s.a[1], s.b[1]) <= p[1] && p[1] <= math.Max(s.a[1], s.b[1])
+}
+
+// 共线线段的重叠部分
+func collinearOverlap(s, o segment) (lo, hi [2]float64, ok bool) {
+	key := func(p [2]float64) float64 { return p[0] }
+	if s.a[0] == s.b[0] {
+		key = func(p [2]float64) float64 { return p[1] }
+	}
+	sLo, sHi := s.a, s.b
+	if key(sLo) > key(sHi) {
+		sLo, sHi = sHi, sLo
+	}
+	oLo, oHi := o.a, o.b
+	if key(oLo) > key(oHi) {
+		oLo, oHi = oHi, oLo
+	}
+	lo, hi = sLo, sHi
+	if key(oLo) > key(lo) {
+		lo = oLo
+	}
+	if key(oHi) < key(hi) {
+		hi = oHi
+	}
+	ok = key(lo) <= key(hi)
+	return
+}
+
+func intersectionPoint(s, o segment) []float64 {
+	x1, y1, x2, y2 := s.a[0], s.a[1], s.b[0], s.b[1]
+	x3, y3, x4, y4 := o.a[0], o.a[1], o.b[0], o.b[1]
+	den := (x1-x2)*(y3-y4) - (y1-y2)*(x3-x4)
+	t := ((x1-x3)*(y3-y4) - (y1-y3)*(x3-x4)) / den
+	return []float64{x1 + t*(x2-x1), y1 + t*(y2-y1)}
+}
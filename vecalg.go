@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"math"
 
-	"github.com/wgdzlh/gdalib/log"
-
 	"github.com/lukeroth/gdal"
 	"go.uber.org/zap"
 )
@@ -19,13 +17,14 @@ const (
 )
 
 func (g *GdalToolbox) parseAlgWKT(wkt string) (ret gdal.Geometry, err error) {
-	ref, err := g.getSridRef(WKT_ALG_SRID)
+	ref, err := g.getSridRef(g.algSrid)
 	if err != nil {
 		return
 	}
+	defer ref.Release()
 	ret, err = gdal.CreateFromWKT(wkt, ref)
 	if err != nil {
-		log.Error(g.logTag+"parse alg wkt failed", zap.Error(err))
+		g.logger.Error(g.logTag+"parse alg wkt failed", zap.Error(err))
 		err = ErrInvalidWKT
 	}
 	return
@@ -35,16 +34,16 @@ func (g *GdalToolbox) simpGeo(geo gdal.Geometry, t float64) (wkt string, err err
 	defer geo.Destroy()
 	// t := config.C.Server.GeoSimplifyT
 	if t <= 0 {
-		t = SimplifyT
+		t = g.simplifyT
 	}
-	log.Info(g.logTag+"simplify geo", zap.Float64("tolerance", t))
+	g.logger.Info(g.logTag+"simplify geo", zap.Float64("tolerance", t))
 	ret := geo.SimplifyPreservingTopology(t)
 	defer ret.Destroy()
 	area := ret.Area()
 	if area <= 0 {
 		return
 	}
-	buff := math.Sqrt(area) * BuffPercent
+	buff := math.Sqrt(area) * g.buffPercent
 	ret = ret.Buffer(-buff, BuffQuadSegs) // 腐蚀
 	ret = ret.Buffer(buff, BuffQuadSegs)  // 膨胀
 	wkt, err = ret.ToWKT()
@@ -81,7 +80,7 @@ func (g *GdalToolbox) muffGeo(geo gdal.Geometry) (ret gdal.Geometry, err error)
 }
 
 func (g *GdalToolbox) Simplify(wkt string) (out string, err error) {
-	log.Info(g.logTag + "start simplify wkt")
+	g.logger.Info(g.logTag + "start simplify wkt")
 	geo, err := g.parseAlgWKT(wkt)
 	if err != nil {
 		return
@@ -91,7 +90,7 @@ func (g *GdalToolbox) Simplify(wkt string) (out string, err error) {
 }
 
 func (g *GdalToolbox) MuffAndSimp(wkt string, t float64) (out string, err error) {
-	log.Info(g.logTag + "start muff and simp wkt")
+	g.logger.Info(g.logTag + "start muff and simp wkt")
 	geo, err := g.parseAlgWKT(wkt)
 	if err != nil {
 		return
@@ -139,7 +138,7 @@ func (g *GdalToolbox) parseAndCheck(wkt, line string) (geo, st gdal.Geometry, np
 }
 
 func (g *GdalToolbox) Cut(wkt, line string) (out []string, err error) {
-	log.Info(g.logTag + "start cut wkt")
+	g.logger.Info(g.logTag + "start cut wkt")
 	geo, st, _, err := g.parseAndCheck(wkt, line)
 	if err != nil {
 		return
@@ -151,7 +150,7 @@ func (g *GdalToolbox) Cut(wkt, line string) (out []string, err error) {
 		out = []string{wkt}
 		return
 	}
-	buffedLine := st.Buffer(CutLineBuffDist, 1)
+	buffedLine := st.Buffer(g.cutBuffer, 1)
 	defer buffedLine.Destroy()
 
 	switch geo.Type() {
@@ -227,7 +226,7 @@ func (g *GdalToolbox) Cut(wkt, line string) (out []string, err error) {
 }
 
 func (g *GdalToolbox) Reshape(wkt, line string) (out string, err error) {
-	log.Info(g.logTag + "start reshape wkt")
+	g.logger.Info(g.logTag + "start reshape wkt")
 	geo, st, np, err := g.parseAndCheck(wkt, line)
 	if err != nil {
 		return
@@ -258,8 +257,8 @@ func (g *GdalToolbox) Reshape(wkt, line string) (out string, err error) {
 		err = ErrWrongLineEndsCount
 		return
 	}
-	// log.Info(g.logTag+"ends within st", zap.Bool("ret", ends.Intersects(st)))
-	buffedLine := st.Buffer(CutLineBuffDist, 1)
+	// g.logger.Info(g.logTag+"ends within st", zap.Bool("ret", ends.Intersects(st)))
+	buffedLine := st.Buffer(g.cutBuffer, 1)
 	defer buffedLine.Destroy()
 
 	if geo.Intersects(ends.Geometry(0)) && geo.Intersects(ends.Geometry(1)) {
@@ -269,7 +268,7 @@ func (g *GdalToolbox) Reshape(wkt, line string) (out string, err error) {
 			return
 		}
 	} else if geo.Disjoint(ends) {
-		// log.Info(g.logTag+"points count of line string", zap.Int("num", np))
+		// g.logger.Info(g.logTag+"points count of line string", zap.Int("num", np))
 		if np <= 3 {
 			if geo, err = removeSmallerPolygons(geo, buffedLine); err != nil {
 				return
@@ -318,12 +317,12 @@ func (g *GdalToolbox) Reshape2(wkt, line string) (out string, err error) {
 	defer geo.Destroy()
 	defer st.Destroy()
 
-	if st.Distance(geo) >= MinIntersectDist {
+	if st.Distance(geo) >= g.minIntersectDist {
 		out = wkt
 		return
 	}
 
-	shrink := geo.Buffer(-MinIntersectDist, 1)
+	shrink := geo.Buffer(-g.minIntersectDist, 1)
 	defer shrink.Destroy()
 
 	if shrink.Contains(st) {
@@ -340,7 +339,7 @@ func (g *GdalToolbox) Reshape2(wkt, line string) (out string, err error) {
 		return
 	}
 
-	expand := geo.Buffer(MinIntersectDist, 1)
+	expand := geo.Buffer(g.minIntersectDist, 1)
 	ends := st.Boundary()
 	defer expand.Destroy()
 	defer ends.Destroy()
@@ -365,26 +364,26 @@ func (g *GdalToolbox) Reshape2(wkt, line string) (out string, err error) {
 		} else {
 			lineParts = emptyGeometry
 		}
-		if geo, err = cropWithLine(geo, st); err != nil {
+		if geo, err = g.cropWithLine(geo, st); err != nil {
 			return
 		}
 		if lineParts != emptyGeometry && !lineParts.IsEmpty() {
 			// wkt, _ := lineParts.ToWKT()
-			// log.Info("line parts", zap.String("t", wkt))
+			// g.logger.Info("line parts", zap.String("t", wkt))
 			defer geo.Destroy()
-			if geo, err = muffWithLine(geo, lineParts); err != nil {
+			if geo, err = g.muffWithLine(geo, lineParts); err != nil {
 				geo.Destroy()
 				return
 			}
 		}
 	} else if expand.Contains(ends) {
 		if crossed {
-			if geo, err = cropWithLine(geo, st); err != nil {
+			if geo, err = g.cropWithLine(geo, st); err != nil {
 				return
 			}
 			defer geo.Destroy()
 		}
-		if geo, err = muffWithLine(geo, st); err != nil {
+		if geo, err = g.muffWithLine(geo, st); err != nil {
 			geo.Destroy()
 			return
 		}
@@ -396,15 +395,15 @@ func (g *GdalToolbox) Reshape2(wkt, line string) (out string, err error) {
 	return
 }
 
-func cropWithLine(geo, st gdal.Geometry) (ret gdal.Geometry, err error) {
-	buffedLine := st.Buffer(MinIntersectDist, 1)
+func (g *GdalToolbox) cropWithLine(geo, st gdal.Geometry) (ret gdal.Geometry, err error) {
+	buffedLine := st.Buffer(g.minIntersectDist, 1)
 	ret, err = removeSmallerPolygons(geo, buffedLine)
 	buffedLine.Destroy()
 	return
 }
 
-func muffWithLine(geo, st gdal.Geometry) (ret gdal.Geometry, err error) {
-	buffedLine := st.Buffer(CutLineBuffDist, 1)
+func (g *GdalToolbox) muffWithLine(geo, st gdal.Geometry) (ret gdal.Geometry, err error) {
+	buffedLine := st.Buffer(g.cutBuffer, 1)
 	ret = geo.Union(buffedLine)
 	if ret.Type() == gdal.GT_Polygon {
 		err = removeConcatHolesInPolygon(ret, buffedLine)
@@ -0,0 +1,282 @@
+package gdalib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lukeroth/gdal"
+	"go.uber.org/zap"
+)
+
+// 矢量输出格式（即OGR驱动名）
+type VectorFormat string
+
+const (
+	FormatShapefile  VectorFormat = SHP_DRIVER_NAME
+	FormatGPKG       VectorFormat = "GPKG"
+	FormatGeoJSON    VectorFormat = "GeoJSON"
+	FormatFlatGeobuf VectorFormat = "FlatGeobuf"
+	FormatCSV        VectorFormat = "CSV" // 几何以WKT列输出
+)
+
+// 按文件扩展名推断输出格式，无法识别时为Shapefile
+func VectorFormatOf(path string) VectorFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case FILE_EXT_GPKG:
+		return FormatGPKG
+	case FILE_EXT_GEOJSON, FILE_EXT_JSON:
+		return FormatGeoJSON
+	case FILE_EXT_FGB:
+		return FormatFlatGeobuf
+	case FILE_EXT_CSV:
+		return FormatCSV
+	}
+	return FormatShapefile
+}
+
+// 该格式创建图层时的选项
+func (f VectorFormat) layerOptions() []string {
+	switch f {
+	case FormatShapefile:
+		return []string{ENCODING_OPTION}
+	case FormatCSV:
+		return []string{"GEOMETRY=AS_WKT"}
+	}
+	return nil
+}
+
+// 矢量数据读写选项
+type VectorOption func(*vectorConfig)
+
+type vectorConfig struct {
+	layerName string       // 图层名，非空时优先按名称选取
+	layerIdx  int          // 图层序号（从0开始）
+	format    VectorFormat // 输出格式，为空时按扩展名推断
+	strict    bool         // 严格写入：任一要素失败即整体放弃
+	repair    bool         // 读取时修复几何
+	// 推断高斯克吕格分带时使用的中央经线（东坐标不带带号前缀时需要）
+	centralMeridian float64
+}
+
+// 按名称选取图层（如GeoPackage中的某个表）
+func WithLayerName(name string) VectorOption {
+	return func(cfg *vectorConfig) {
+		cfg.layerName = name
+	}
+}
+
+// 按序号选取图层，默认为第一个图层
+func WithLayerIndex(idx int) VectorOption {
+	return func(cfg *vectorConfig) {
+		cfg.layerIdx = idx
+	}
+}
+
+// 指定输出格式（默认按输出文件扩展名推断）
+func WithFormat(format VectorFormat) VectorOption {
+	return func(cfg *vectorConfig) {
+		cfg.format = format
+	}
+}
+
+// 严格写入模式：先写入临时目录，任一要素写入失败时返回*WriteError且不改动目标文件，
+// 全部成功后才将文件组（shp为.shp/.shx/.dbf/.prj/.cpg）改名移入目标位置
+func WithStrict() VectorOption {
+	return func(cfg *vectorConfig) {
+		cfg.strict = true
+	}
+}
+
+// 读取要素时修复几何（见RepairGeometry），修复失败的要素按几何错误处理
+func WithRepair() VectorOption {
+	return func(cfg *vectorConfig) {
+		cfg.repair = true
+	}
+}
+
+// 指定推断CGCS2000高斯克吕格分带时使用的中央经线（见InferCGCS2000GK）
+func WithCentralMeridian(cm float64) VectorOption {
+	return func(cfg *vectorConfig) {
+		cfg.centralMeridian = cm
+	}
+}
+
+func newVectorConfig(opts []VectorOption) *vectorConfig {
+	cfg := &vectorConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// 打开任意OGR可读的矢量数据源（Shapefile、GeoPackage、GeoJSON、KML、FlatGeobuf等），并选取图层
+// 数据格式由OGR自动探测，返回的ds需调用方Destroy
+func (g *GdalToolbox) openVector(path string, update bool, opts ...VectorOption) (ds gdal.DataSource, layer gdal.Layer, err error) {
+	cfg := newVectorConfig(opts)
+	mode := 0
+	if update {
+		mode = 1
+	}
+	if ds = gdal.OpenDataSource(path, mode); ds == (gdal.DataSource{}) {
+		g.logger.Error(g.logTag+"open vector failed", zap.String("path", path))
+		err = ErrGdalDriverOpen
+		return
+	}
+	driverName := ds.Driver().Name()
+	if layer, err = selectLayer(ds, cfg); err != nil {
+		g.logger.Error(g.logTag+"vector layer not found", zap.String("path", path), zap.String("layer", cfg.layerName), zap.Int("idx", cfg.layerIdx))
+		ds.Destroy()
+		return
+	}
+	g.logger.Debug(g.logTag+"vector opened", zap.String("path", path), zap.String("driver", driverName), zap.String("layer", layer.Name()))
+	return
+}
+
+func selectLayer(ds gdal.DataSource, cfg *vectorConfig) (layer gdal.Layer, err error) {
+	n := ds.LayerCount()
+	if cfg.layerName != "" {
+		for i := 0; i < n; i++ {
+			if layer = ds.LayerByIndex(i); layer.Name() == cfg.layerName {
+				return
+			}
+		}
+		err = ErrLayerNotFound
+		return
+	}
+	if cfg.layerIdx < 0 || cfg.layerIdx >= n {
+		err = ErrLayerNotFound
+		return
+	}
+	layer = ds.LayerByIndex(cfg.layerIdx)
+	return
+}
+
+// 获取输出格式
+func (cfg *vectorConfig) outputFormat(path string) VectorFormat {
+	if cfg.format != "" {
+		return cfg.format
+	}
+	return VectorFormatOf(path)
+}
+
+// 按指定格式及坐标系创建矢量文件及其中的单个图层（图层名取自文件名），返回的ref需调用方Release
+func (g *GdalToolbox) createVector(path string, crs CRS, format VectorFormat) (ds gdal.DataSource, ref gdal.SpatialReference, layer gdal.Layer, err error) {
+	g.logger.Info(g.logTag+"output vector files", zap.String("path", path), zap.String("format", string(format)), zap.String("crs", string(crs)))
+	driver := gdal.OGRDriverByName(string(format))
+	ds, ok := driver.Create(path, nil)
+	if !ok {
+		err = ErrGdalDriverCreate
+		return
+	}
+	if ref, err = g.getCRSRef(crs); err != nil {
+		ds.Destroy()
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	layer = ds.CreateLayer(name, ref, gdal.GT_Unknown, format.layerOptions())
+	if layer == (gdal.Layer{}) {
+		// 驱动不接受图层选项或坐标系时返回空图层
+		g.logger.Error(g.logTag+"create vector layer failed", zap.String("path", path), zap.String("format", string(format)))
+		ds.Destroy()
+		ref.Release()
+		deleteVector(path, format)
+		err = ErrGdalDriverCreate
+	}
+	return
+}
+
+// 删除矢量文件（shp时包括其附属文件）
+func deleteVector(path string, format VectorFormat) {
+	gdal.OGRDriverByName(string(format)).Delete(path)
+}
+
+// shp文件组中的各文件扩展名，.shp放在最后，保证其出现时其余文件已就位
+var shpFileSet = []string{".shx", ".dbf", ".prj", ".cpg", FILE_EXT_SHP}
+
+// 矢量写入目标，严格模式下实际写入同目录下的临时目录
+type vectorWriter struct {
+	path   string       // 目标路径
+	out    string       // 实际写入路径
+	tmpDir string       // 临时目录（非严格模式为空）
+	format VectorFormat // 输出格式
+	layer  gdal.Layer
+	fails  []WriteFailure
+}
+
+// 创建矢量写入目标及其图层
+func (g *GdalToolbox) createWriter(path string, crs CRS, opts []VectorOption) (w *vectorWriter, ds gdal.DataSource, ref gdal.SpatialReference, layer gdal.Layer, err error) {
+	cfg := newVectorConfig(opts)
+	w = &vectorWriter{path: path, out: path, format: cfg.outputFormat(path)}
+	if cfg.strict {
+		// 临时目录与目标同目录，保证改名不跨文件系统
+		if w.tmpDir, err = os.MkdirTemp(filepath.Dir(path), ".gdalib-"); err != nil {
+			g.logger.Error(g.logTag+"create tmp dir failed", zap.String("path", path), zap.Error(err))
+			return
+		}
+		w.out = filepath.Join(w.tmpDir, filepath.Base(path))
+	}
+	if ds, ref, layer, err = g.createVector(w.out, crs, w.format); err != nil {
+		if w.tmpDir != "" {
+			os.RemoveAll(w.tmpDir)
+		}
+		return
+	}
+	w.layer = layer
+	return
+}
+
+// 记录写入失败的要素
+func (w *vectorWriter) fail(idx int, err error) {
+	w.fails = append(w.fails, WriteFailure{Index: idx, Err: newFeatureError(w.path, w.layer, int64(idx), err)})
+}
+
+// 关闭写入的矢量文件：
+// 严格模式下有要素失败时返回*WriteError并丢弃临时文件，否则将临时文件移入目标位置；
+// 非严格模式下若因ctx取消而中断则删除未写完的文件
+func (g *GdalToolbox) closeWriter(ctx context.Context, w *vectorWriter, ds gdal.DataSource, err *error) {
+	ds.Destroy()
+	if w.tmpDir == "" {
+		if *err != nil && ctx.Err() != nil {
+			g.logger.Info(g.logTag+"remove canceled vector", zap.String("path", w.path), zap.Error(*err))
+			deleteVector(w.path, w.format)
+		}
+		return
+	}
+	defer os.RemoveAll(w.tmpDir)
+	if *err == nil && len(w.fails) > 0 {
+		*err = &WriteError{Path: w.path, Failures: w.fails}
+	}
+	if *err != nil {
+		g.logger.Error(g.logTag+"strict write aborted", zap.String("path", w.path), zap.Int("failed", len(w.fails)), zap.Error(*err))
+		return
+	}
+	if *err = w.commit(); *err != nil {
+		g.logger.Error(g.logTag+"move vector into place failed", zap.String("path", w.path), zap.Error(*err))
+	}
+}
+
+// 将临时目录中的文件改名移入目标位置
+func (w *vectorWriter) commit() (err error) {
+	dir := filepath.Dir(w.path)
+	if w.format != FormatShapefile {
+		return os.Rename(w.out, w.path)
+	}
+	stem := strings.TrimSuffix(filepath.Base(w.path), filepath.Ext(w.path))
+	for _, ext := range shpFileSet {
+		src := filepath.Join(w.tmpDir, stem+ext)
+		dst := filepath.Join(dir, stem+ext)
+		if _, e := os.Stat(src); e != nil {
+			// 新文件组中没有该文件时，删除目标位置的旧文件，避免混用
+			if e = os.Remove(dst); e != nil && !os.IsNotExist(e) {
+				return e
+			}
+			continue
+		}
+		if err = os.Rename(src, dst); err != nil {
+			return
+		}
+	}
+	return
+}